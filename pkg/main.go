@@ -1,9 +1,6 @@
 package main
 
 import (
-	"context"
-	"github.com/grafana/grafana-plugin-sdk-go/backend"
-	"github.com/grafana/grafana-plugin-sdk-go/backend/instancemgmt"
 	"os"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend/datasource"
@@ -20,13 +17,7 @@ func main() {
 	// from Grafana to create different instances of TrinoDatasource (per datasource
 	// ID). When datasource configuration changed Dispose method will be called and
 	// new datasource instance created using New factory.
-	s := &trino.TrinoDatasource{}
-	ds := trino.NewDatasource(s)
-	ds.Completable = s
-	dsInstanceFactory := func(ctx context.Context, settings backend.DataSourceInstanceSettings) (instancemgmt.Instance, error) {
-		return ds.NewDatasource(ctx, settings)
-	}
-	if err := datasource.Manage("trino-datasource", dsInstanceFactory, datasource.ManageOpts{}); err != nil {
+	if err := datasource.Manage("trino-datasource", trino.NewInstance, datasource.ManageOpts{}); err != nil {
 		log.DefaultLogger.Error(err.Error())
 		os.Exit(1)
 	}
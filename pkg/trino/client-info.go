@@ -0,0 +1,117 @@
+package trino
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// Headers set by Grafana on query requests.
+const (
+	dashboardUIDHeader = "X-Dashboard-Uid"
+	panelIDHeader      = "X-Panel-Id"
+	ruleUIDHeader      = "X-Rule-Uid"
+)
+
+// Request types of the client info.
+const (
+	requestTypeDashboard = "dashboard"
+	requestTypeExplore   = "explore"
+	requestTypeAlert     = "alert"
+)
+
+// clientInfo describes where a query comes from in Grafana. It is sent as
+// the Trino client info, and as client tags, so that resource groups and
+// event listeners can attribute the load.
+type clientInfo struct {
+	RequestType  string `json:"requestType"`
+	OrgID        int64  `json:"orgId,omitempty"`
+	DashboardUID string `json:"dashboardUid,omitempty"`
+	PanelID      string `json:"panelId,omitempty"`
+	AlertRuleUID string `json:"alertRuleUid,omitempty"`
+}
+
+// newClientInfo returns the client info of a query request. Requests from
+// alert rules are marked by the FromAlert header, and requests from
+// dashboards by their dashboard UID. Other requests come from Explore.
+func newClientInfo(req *backend.QueryDataRequest) clientInfo {
+	info := clientInfo{
+		RequestType:  requestTypeExplore,
+		OrgID:        req.PluginContext.OrgID,
+		DashboardUID: requestHeader(req, dashboardUIDHeader),
+		PanelID:      requestHeader(req, panelIDHeader),
+		AlertRuleUID: requestHeader(req, ruleUIDHeader),
+	}
+	switch {
+	case requestHeader(req, backend.FromAlertHeaderName) == "true" || info.AlertRuleUID != "":
+		info.RequestType = requestTypeAlert
+	case info.DashboardUID != "":
+		info.RequestType = requestTypeDashboard
+	}
+	return info
+}
+
+// requestHeader returns a header of a query request, forwarded as an HTTP
+// header or set by Grafana itself, like FromAlert.
+func requestHeader(req *backend.QueryDataRequest, name string) string {
+	if value := req.GetHTTPHeader(name); value != "" {
+		return value
+	}
+	return req.Headers[name]
+}
+
+// json returns the client info as the value of the X-Trino-Client-Info
+// header.
+func (i clientInfo) json() string {
+	b, err := json.Marshal(i)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// tags returns the client tags of the client info, e.g. "grafana:dashboard"
+// and "dashboard:<uid>".
+func (i clientInfo) tags() []string {
+	tags := []string{"grafana:" + i.RequestType}
+	if i.OrgID != 0 {
+		tags = append(tags, "org:"+strconv.FormatInt(i.OrgID, 10))
+	}
+	if i.DashboardUID != "" {
+		tags = append(tags, "dashboard:"+i.DashboardUID)
+	}
+	if i.PanelID != "" {
+		tags = append(tags, "panel:"+i.PanelID)
+	}
+	if i.AlertRuleUID != "" {
+		tags = append(tags, "alert-rule:"+i.AlertRuleUID)
+	}
+	return tags
+}
+
+// mergeClientTags returns the client tags configured for the data source,
+// followed by the tags of the client info. Tags with commas, which separate
+// the tags, and duplicates are dropped.
+func mergeClientTags(configured string, info clientInfo) string {
+	var tags []string
+	seen := map[string]bool{}
+	add := func(tag string) {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] || strings.Contains(tag, ",") {
+			return
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	if configured != "" {
+		for _, tag := range strings.Split(configured, ",") {
+			add(tag)
+		}
+	}
+	for _, tag := range info.tags() {
+		add(tag)
+	}
+	return strings.Join(tags, ",")
+}
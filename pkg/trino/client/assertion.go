@@ -0,0 +1,140 @@
+package client
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// clientAssertionType is the type of the client assertions of the
+// private_key_jwt authentication method.
+const clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// clientAssertionLifetime is how long client assertions are valid.
+const clientAssertionLifetime = 5 * time.Minute
+
+// ParsePrivateKey parses a PEM encoded RSA or EC private key, in PKCS #8,
+// PKCS #1 or SEC 1 form, used to sign client assertions.
+func ParsePrivateKey(key string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(key))
+	if block == nil {
+		return nil, errors.New("client private key must be PEM encoded")
+	}
+	if parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		switch parsed := parsed.(type) {
+		case *rsa.PrivateKey:
+			return parsed, nil
+		case *ecdsa.PrivateKey:
+			return parsed, nil
+		default:
+			return nil, errors.New("client private key must be an RSA or EC key")
+		}
+	}
+	if parsed, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return parsed, nil
+	}
+	if parsed, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return parsed, nil
+	}
+	return nil, errors.New("client private key must be an RSA or EC private key")
+}
+
+// clientAssertion returns a JWT identifying the client to the token endpoint,
+// signed with its private key, as described in RFC 7523. RSA keys sign with
+// RS256, and EC keys with ES256, ES384 or ES512 depending on their curve.
+func (c *Client) clientAssertion(tokenURL string, now time.Time) (string, error) {
+	alg, hash, err := signingAlgorithm(c.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if c.KeyId != "" {
+		header["kid"] = c.KeyId
+	}
+	claims := map[string]interface{}{
+		"iss": c.ClientId,
+		"sub": c.ClientId,
+		"aud": tokenURL,
+		"jti": hex.EncodeToString(id),
+		"iat": now.Unix(),
+		"exp": now.Add(clientAssertionLifetime).Unix(),
+	}
+	encodedHeader, err := encodeSegment(header)
+	if err != nil {
+		return "", err
+	}
+	encodedClaims, err := encodeSegment(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := encodedHeader + "." + encodedClaims
+
+	digest := hash.New()
+	digest.Write([]byte(signingInput))
+	signature, err := sign(c.PrivateKey, hash, digest.Sum(nil))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign the client assertion: %w", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func signingAlgorithm(key crypto.Signer) (string, crypto.Hash, error) {
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return "RS256", crypto.SHA256, nil
+	case *ecdsa.PrivateKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return "ES256", crypto.SHA256, nil
+		case elliptic.P384():
+			return "ES384", crypto.SHA384, nil
+		case elliptic.P521():
+			return "ES512", crypto.SHA512, nil
+		}
+		return "", 0, fmt.Errorf("unsupported client private key curve %s", key.Curve.Params().Name)
+	case nil:
+		return "", 0, errors.New("client private key is required for private_key_jwt")
+	}
+	return "", 0, errors.New("client private key must be an RSA or EC key")
+}
+
+// sign signs a digest, with the fixed size r || s encoding of JWS for EC
+// keys.
+func sign(key crypto.Signer, hash crypto.Hash, digest []byte) ([]byte, error) {
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return key.Sign(rand.Reader, digest, hash)
+	}
+	r, s, err := ecdsa.Sign(rand.Reader, ecKey, digest)
+	if err != nil {
+		return nil, err
+	}
+	size := (ecKey.Curve.Params().BitSize + 7) / 8
+	signature := make([]byte, 2*size)
+	r.FillBytes(signature[:size])
+	s.FillBytes(signature[size:])
+	return signature, nil
+}
+
+func encodeSegment(value interface{}) (string, error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,171 @@
+package client
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePrivateKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec1, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		key     string
+		wantErr bool
+	}{
+		{name: "PKCS #1 RSA key", key: encodePEM("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))},
+		{name: "PKCS #8 EC key", key: encodePEM("PRIVATE KEY", pkcs8)},
+		{name: "SEC 1 EC key", key: encodePEM("EC PRIVATE KEY", sec1)},
+		{name: "not PEM", key: "secret", wantErr: true},
+		{name: "not a key", key: encodePEM("PRIVATE KEY", []byte("secret")), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParsePrivateKey(tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePrivateKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClient_ClientAssertion(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p521Key, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		key  crypto.Signer
+		alg  string
+	}{
+		{name: "RSA", key: rsaKey, alg: "RS256"},
+		{name: "EC P-256", key: p256Key, alg: "ES256"},
+		{name: "EC P-384", key: p384Key, alg: "ES384"},
+		{name: "EC P-521", key: p521Key, alg: "ES512"},
+	}
+	now := time.Unix(1700000000, 0)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{ClientId: "grafana", PrivateKey: tt.key, KeyId: "key-1"}
+			assertion, err := c.clientAssertion("https://idp.example/token", now)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			header, claims := verifyClientAssertion(t, tt.key.Public(), assertion)
+			if header["alg"] != tt.alg || header["kid"] != "key-1" || header["typ"] != "JWT" {
+				t.Errorf("unexpected header: %v", header)
+			}
+			if claims["iss"] != "grafana" || claims["sub"] != "grafana" || claims["aud"] != "https://idp.example/token" {
+				t.Errorf("unexpected claims: %v", claims)
+			}
+			if claims["iat"] != float64(now.Unix()) || claims["exp"] != float64(now.Add(clientAssertionLifetime).Unix()) {
+				t.Errorf("unexpected claim times: %v", claims)
+			}
+			if jti, _ := claims["jti"].(string); jti == "" {
+				t.Error("expected a jti claim")
+			}
+		})
+	}
+}
+
+func TestClient_ClientAssertionRequiresKey(t *testing.T) {
+	c := &Client{ClientId: "grafana"}
+	if _, err := c.clientAssertion("https://idp.example/token", time.Now()); err == nil {
+		t.Fatal("expected a missing private key error")
+	}
+}
+
+// verifyClientAssertion checks the signature of a client assertion with the
+// public key, and returns its header and claims.
+func verifyClientAssertion(t *testing.T, key crypto.PublicKey, assertion string) (map[string]interface{}, map[string]interface{}) {
+	t.Helper()
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 3 {
+		t.Fatalf("expected a JWT with 3 parts, got %q", assertion)
+	}
+	header := decodeSegment(t, parts[0])
+	claims := decodeSegment(t, parts[1])
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatalf("invalid signature encoding: %v", err)
+	}
+
+	hash := map[string]crypto.Hash{"RS256": crypto.SHA256, "ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512}[header["alg"].(string)]
+	digest := hash.New()
+	digest.Write([]byte(parts[0] + "." + parts[1]))
+	valid := false
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		valid = rsa.VerifyPKCS1v15(key, hash, digest.Sum(nil), signature) == nil
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			t.Fatalf("got a signature of %d bytes, want %d", len(signature), 2*size)
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		valid = ecdsa.Verify(key, digest.Sum(nil), r, s)
+	}
+	if !valid {
+		t.Fatal("invalid client assertion signature")
+	}
+	return header, claims
+}
+
+func decodeSegment(t *testing.T, segment string) map[string]interface{} {
+	t.Helper()
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		t.Fatalf("invalid segment encoding: %v", err)
+	}
+	value := map[string]interface{}{}
+	if err := json.Unmarshal(b, &value); err != nil {
+		t.Fatalf("invalid segment: %v", err)
+	}
+	return value
+}
+
+func encodePEM(blockType string, der []byte) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}))
+}
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"crypto"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -8,21 +9,56 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
 	"sync"
 	"time"
 )
 
+// Token endpoint authentication methods of the client.
+const (
+	AuthMethodClientSecretPost  = "client_secret_post"
+	AuthMethodClientSecretBasic = "client_secret_basic"
+	AuthMethodPrivateKeyJWT     = "private_key_jwt"
+)
+
 type Client struct {
 	*http.Client
 	ClientId          string
 	ClientSecret      string
 	Url               string
 	ImpersonationUser string
+	// IssuerUrl is used to discover the token endpoint when Url is not set.
+	IssuerUrl string
+	// Scopes, Audience and Resource are sent with the token request when
+	// set, as well as the extra form parameters of Params.
+	Scopes   []string
+	Audience string
+	Resource string
+	Params   map[string]string
+	// AuthMethod is the token endpoint authentication method, defaulting to
+	// client_secret_post. The private_key_jwt method signs client assertions
+	// with PrivateKey, identified by KeyId.
+	AuthMethod string
+	PrivateKey crypto.Signer
+	KeyId      string
+	// TokenExchange exchanges tokens for the subject of the requests, set
+	// with WithSubject, instead of using the client token.
+	TokenExchange bool
+	// UserParam is the parameter naming the user when the client token is
+	// exchanged, defaulting to DefaultUserParam.
+	UserParam string
 
-	// lock and token are per-instance so that concurrent datasource instances
-	// with different credentials never share or clobber each other's token.
-	lock  sync.Mutex
-	token *Token
+	// lock, token, exchanged and metadata are per-instance so that concurrent
+	// datasource instances with different credentials never share or clobber
+	// each other's token. The lock is never held during requests to the
+	// identity provider: refresh and discovery serialize the retrieval of the
+	// client token and of the metadata.
+	lock      sync.Mutex
+	refresh   sync.Mutex
+	discovery sync.Mutex
+	token     *Token
+	exchanged map[string]*exchangedToken
+	metadata  *providerMetadata
 }
 
 func (c *Client) Do(req *http.Request) (*http.Response, error) {
@@ -33,12 +69,24 @@ func (c *Client) Do(req *http.Request) (*http.Response, error) {
 		return nil, errors.New("Trino URL must include a host")
 	}
 
-	token, err := c.getToken()
+	// Requests without a subject, like health checks, use the client token.
+	subject, exchange := req.Context().Value(subjectKey{}).(Subject)
+	exchange = exchange && c.TokenExchange
+	var token *Token
+	var err error
+	if exchange {
+		token, err = c.exchangeToken(subject)
+	} else {
+		token, err = c.getToken()
+	}
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
-	if c.ImpersonationUser != "" {
+	if exchange {
+		// Trino identifies the user with the exchanged token.
+		req.Header.Del("X-Trino-User")
+	} else if c.ImpersonationUser != "" {
 		req.Header.Set("X-Trino-User", c.ImpersonationUser)
 	}
 	// #nosec G704 -- the administrator-configured Trino URL is restricted to HTTP(S) above.
@@ -46,29 +94,110 @@ func (c *Client) Do(req *http.Request) (*http.Response, error) {
 }
 
 func (c *Client) getToken() (*Token, error) {
+	if token := c.clientToken(); token != nil {
+		return token, nil
+	}
+	c.refresh.Lock()
+	defer c.refresh.Unlock()
+	// The token may have been retrieved while waiting for the lock.
+	if token := c.clientToken(); token != nil {
+		return token, nil
+	}
+	values := url.Values{}
+	values.Set("grant_type", "client_credentials")
+	newToken, err := c.requestToken(values)
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	c.token = newToken
+	c.lock.Unlock()
+	return newToken, nil
+}
+
+// clientToken returns the cached client credentials token, unless it almost
+// expires.
+func (c *Client) clientToken() *Token {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 	if c.token != nil && !c.token.isAlmostExpired() {
-		return c.token, nil
+		return c.token
 	}
-	newToken, err := c.retrieveToken()
+	return nil
+}
+
+// requestToken requests a token with the grant values from the token
+// endpoint, discovering it again if the request fails.
+func (c *Client) requestToken(grant url.Values) (*Token, error) {
+	tokenURL, err := c.tokenURL()
 	if err != nil {
 		return nil, err
 	}
-	c.token = newToken
-	return c.token, nil
+	token, err := c.retrieveToken(tokenURL, grant)
+	if err != nil && c.Url == "" {
+		// The discovered token endpoint may have changed.
+		log.DefaultLogger.Debug("Token request failed, discovering the token endpoint again", "error", err)
+		c.discovery.Lock()
+		metadata, discoverErr := c.discover()
+		c.discovery.Unlock()
+		if discoverErr != nil {
+			return nil, err
+		}
+		token, err = c.retrieveToken(metadata.TokenEndpoint, grant)
+	}
+	return token, err
 }
 
-func (c *Client) retrieveToken() (*Token, error) {
-	log.DefaultLogger.Debug("Try retrieve token")
-	values := url.Values{
-		"client_id":     []string{c.ClientId},
-		"client_secret": []string{c.ClientSecret},
-		"grant_type":    []string{"client_credentials"},
+func (c *Client) retrieveToken(tokenURL string, grant url.Values) (*Token, error) {
+	log.DefaultLogger.Debug("Try retrieve token", "grantType", grant.Get("grant_type"))
+	values := url.Values{}
+	for name, value := range c.Params {
+		values.Set(name, value)
+	}
+	for name, value := range grant {
+		values[name] = value
+	}
+	if len(c.Scopes) > 0 {
+		values.Set("scope", strings.Join(c.Scopes, " "))
+	}
+	if c.Audience != "" {
+		values.Set("audience", c.Audience)
+	}
+	if c.Resource != "" {
+		values.Set("resource", c.Resource)
+	}
+
+	basicAuth := false
+	switch c.AuthMethod {
+	case "", AuthMethodClientSecretPost:
+		values.Set("client_id", c.ClientId)
+		values.Set("client_secret", c.ClientSecret)
+	case AuthMethodClientSecretBasic:
+		basicAuth = true
+	case AuthMethodPrivateKeyJWT:
+		assertion, err := c.clientAssertion(tokenURL, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		values.Set("client_id", c.ClientId)
+		values.Set("client_assertion_type", clientAssertionType)
+		values.Set("client_assertion", assertion)
+	default:
+		return nil, fmt.Errorf("unsupported token endpoint authentication method %q", c.AuthMethod)
+	}
+
+	request, err := http.NewRequest(http.MethodPost, tokenURL, strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the token request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if basicAuth {
+		// RFC 6749 requires the credentials to be form encoded first.
+		request.SetBasicAuth(url.QueryEscape(c.ClientId), url.QueryEscape(c.ClientSecret))
 	}
 
 	token := &Token{}
-	response, err := c.PostForm(c.Url, values)
+	response, err := c.Client.Do(request)
 	if err != nil {
 		return nil, fmt.Errorf("failed to request the token response: %w", err)
 	}
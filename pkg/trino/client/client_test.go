@@ -1,10 +1,14 @@
 package client
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
 	"sync/atomic"
 	"testing"
 )
@@ -44,6 +48,137 @@ func TestClient_TokenIsCachedPerInstance(t *testing.T) {
 	}
 }
 
+func TestClient_TokenRequestParameters(t *testing.T) {
+	tests := []struct {
+		name   string
+		client *Client
+		want   url.Values
+	}{
+		{
+			name:   "client credentials",
+			client: &Client{ClientId: "id", ClientSecret: "secret"},
+			want: url.Values{
+				"client_id":     {"id"},
+				"client_secret": {"secret"},
+				"grant_type":    {"client_credentials"},
+			},
+		},
+		{
+			name: "scopes, audience, resource and extra parameters",
+			client: &Client{
+				ClientId:     "id",
+				ClientSecret: "secret",
+				Scopes:       []string{"openid", "trino"},
+				Audience:     "trino",
+				Resource:     "api://trino",
+				Params:       map[string]string{"tenant": "analytics", "client_id": "other"},
+			},
+			want: url.Values{
+				"client_id":     {"id"},
+				"client_secret": {"secret"},
+				"grant_type":    {"client_credentials"},
+				"scope":         {"openid trino"},
+				"audience":      {"trino"},
+				"resource":      {"api://trino"},
+				"tenant":        {"analytics"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var form url.Values
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := r.ParseForm(); err != nil {
+					t.Errorf("failed to parse the token request: %v", err)
+				}
+				form = r.PostForm
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "token", "expires_in": 3600})
+			}))
+			defer server.Close()
+
+			c := tt.client
+			c.Client = http.DefaultClient
+			c.Url = server.URL
+			if _, err := c.getToken(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(form, tt.want) {
+				t.Errorf("unexpected token request parameters: got %v, want %v", form, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_TokenEndpointAuthMethods(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		client *Client
+		check  func(t *testing.T, r *http.Request, tokenURL string)
+	}{
+		{
+			name:   "client_secret_basic",
+			client: &Client{ClientId: "id:1", ClientSecret: "secret&1", AuthMethod: AuthMethodClientSecretBasic},
+			check: func(t *testing.T, r *http.Request, tokenURL string) {
+				id, secret, ok := r.BasicAuth()
+				if !ok || id != "id%3A1" || secret != "secret%261" {
+					t.Errorf("unexpected basic auth: %q, %q", id, secret)
+				}
+				if r.PostForm.Has("client_id") || r.PostForm.Has("client_secret") {
+					t.Errorf("client credentials were posted in the form: %v", r.PostForm)
+				}
+			},
+		},
+		{
+			name:   "private_key_jwt",
+			client: &Client{ClientId: "id", AuthMethod: AuthMethodPrivateKeyJWT, PrivateKey: key},
+			check: func(t *testing.T, r *http.Request, tokenURL string) {
+				if _, _, ok := r.BasicAuth(); ok {
+					t.Error("unexpected basic auth")
+				}
+				if r.PostForm.Has("client_secret") {
+					t.Errorf("client secret was posted in the form: %v", r.PostForm)
+				}
+				if r.PostForm.Get("client_id") != "id" || r.PostForm.Get("client_assertion_type") != clientAssertionType {
+					t.Errorf("unexpected form: %v", r.PostForm)
+				}
+				_, claims := verifyClientAssertion(t, key.Public(), r.PostForm.Get("client_assertion"))
+				if claims["aud"] != tokenURL {
+					t.Errorf("got audience %v, want %q", claims["aud"], tokenURL)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var server *httptest.Server
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := r.ParseForm(); err != nil {
+					t.Errorf("failed to parse the token request: %v", err)
+				}
+				tt.check(t, r, server.URL)
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "token", "expires_in": 3600})
+			}))
+			defer server.Close()
+
+			c := tt.client
+			c.Client = http.DefaultClient
+			c.Url = server.URL
+			if _, err := c.getToken(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
 func TestClient_TokensAreNotSharedAcrossInstances(t *testing.T) {
 	serverA, _ := newTokenServer(t, "token-a")
 	serverB, _ := newTokenServer(t, "token-b")
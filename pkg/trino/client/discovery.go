@@ -0,0 +1,94 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/trinodb/grafana-trino/pkg/trino/models"
+)
+
+// discoveryPath is the path of the OpenID provider metadata, relative to the
+// issuer URL.
+const discoveryPath = "/.well-known/openid-configuration"
+
+// providerMetadata holds the OpenID provider metadata used by the client.
+type providerMetadata struct {
+	Issuer        string `json:"issuer"`
+	TokenEndpoint string `json:"token_endpoint"`
+}
+
+// tokenURL returns the configured token URL, or else the token endpoint
+// discovered from the issuer, which is cached until discover is called
+// again.
+func (c *Client) tokenURL() (string, error) {
+	if c.Url != "" {
+		return c.Url, nil
+	}
+	if metadata := c.cachedMetadata(); metadata != nil {
+		return metadata.TokenEndpoint, nil
+	}
+	c.discovery.Lock()
+	defer c.discovery.Unlock()
+	// The metadata may have been discovered while waiting for the lock.
+	if metadata := c.cachedMetadata(); metadata != nil {
+		return metadata.TokenEndpoint, nil
+	}
+	metadata, err := c.discover()
+	if err != nil {
+		return "", err
+	}
+	return metadata.TokenEndpoint, nil
+}
+
+func (c *Client) cachedMetadata() *providerMetadata {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.metadata
+}
+
+// discover fetches the OpenID provider metadata of the issuer, and caches
+// it. The discovery lock must be held.
+func (c *Client) discover() (*providerMetadata, error) {
+	if c.IssuerUrl == "" {
+		return nil, errors.New("OAuth token URL or issuer URL is required")
+	}
+	discoveryURL := strings.TrimSuffix(c.IssuerUrl, "/") + discoveryPath
+	log.DefaultLogger.Debug("Discovering OpenID provider metadata", "url", discoveryURL)
+
+	response, err := c.Get(discoveryURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request the OpenID provider metadata: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, errors.New("Cannot obtain OpenID provider metadata from IDP. Status code=" + response.Status)
+	}
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the OpenID provider metadata: %w", err)
+	}
+	metadata := &providerMetadata{}
+	if err := json.Unmarshal(body, metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode the OpenID provider metadata: %w", err)
+	}
+	// The issuer of the metadata must be the configured one, as required by
+	// OpenID Connect Discovery, up to a trailing slash.
+	if strings.TrimSuffix(metadata.Issuer, "/") != strings.TrimSuffix(c.IssuerUrl, "/") {
+		return nil, fmt.Errorf("discovered issuer %q doesn't match the issuer URL %q", metadata.Issuer, c.IssuerUrl)
+	}
+	if metadata.TokenEndpoint == "" {
+		return nil, errors.New("discovered token endpoint is missing")
+	}
+	if _, err := models.ParseHTTPURL(metadata.TokenEndpoint, "discovered token endpoint"); err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	c.metadata = metadata
+	c.lock.Unlock()
+	return metadata, nil
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newIssuer returns an OpenID provider serving its metadata, with the token
+// endpoint returned by tokenEndpoint, and tokens that expire immediately.
+func newIssuer(t *testing.T, tokenEndpoint func(issuer string) string) (*httptest.Server, *int32) {
+	var discoveries int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/realms/trino" + discoveryPath:
+			atomic.AddInt32(&discoveries, 1)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"issuer":         server.URL + "/realms/trino",
+				"token_endpoint": tokenEndpoint(server.URL),
+			})
+		case "/realms/trino/token":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "token", "expires_in": 0})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &discoveries
+}
+
+func TestClient_DiscoversTokenEndpoint(t *testing.T) {
+	issuer, discoveries := newIssuer(t, func(issuer string) string { return issuer + "/realms/trino/token" })
+	c := &Client{Client: http.DefaultClient, ClientId: "id", ClientSecret: "secret", IssuerUrl: issuer.URL + "/realms/trino/"}
+
+	for i := 0; i < 2; i++ {
+		token, err := c.getToken()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if token.AccessToken != "token" {
+			t.Errorf("unexpected token: %q", token.AccessToken)
+		}
+	}
+	if got := atomic.LoadInt32(discoveries); got != 1 {
+		t.Errorf("expected the metadata to be discovered once (cached for the second token), got %d discoveries", got)
+	}
+}
+
+func TestClient_RediscoversTokenEndpointOnFailure(t *testing.T) {
+	var moved atomic.Bool
+	issuer, discoveries := newIssuer(t, func(issuer string) string {
+		if moved.Load() {
+			return issuer + "/realms/trino/token"
+		}
+		return issuer + "/realms/trino/old-token"
+	})
+	c := &Client{Client: http.DefaultClient, ClientId: "id", ClientSecret: "secret", IssuerUrl: issuer.URL + "/realms/trino"}
+
+	if _, err := c.discover(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	moved.Store(true)
+	token, err := c.getToken()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token.AccessToken != "token" {
+		t.Errorf("unexpected token: %q", token.AccessToken)
+	}
+	if got := atomic.LoadInt32(discoveries); got != 2 {
+		t.Errorf("expected the metadata to be discovered again after the failure, got %d discoveries", got)
+	}
+}
+
+func TestClient_RejectsInvalidDiscoveredEndpoints(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+	}{
+		{name: "missing", endpoint: ""},
+		{name: "unsupported scheme", endpoint: "file:///tmp/token"},
+		{name: "missing host", endpoint: "https:///token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer, _ := newIssuer(t, func(string) string { return tt.endpoint })
+			c := &Client{Client: http.DefaultClient, IssuerUrl: issuer.URL + "/realms/trino"}
+			if _, err := c.getToken(); err == nil {
+				t.Fatal("expected an invalid token endpoint error")
+			}
+		})
+	}
+}
+
+func TestClient_RejectsMismatchedIssuer(t *testing.T) {
+	issuer, _ := newIssuer(t, func(issuer string) string { return issuer + "/realms/trino/token" })
+	// The metadata of the realm is served for another issuer URL.
+	other := httptest.NewServer(http.RedirectHandler(issuer.URL+"/realms/trino"+discoveryPath, http.StatusFound))
+	t.Cleanup(other.Close)
+	c := &Client{Client: http.DefaultClient, IssuerUrl: other.URL + "/realms/trino"}
+	if _, err := c.discover(); err == nil || !strings.Contains(err.Error(), "doesn't match the issuer URL") {
+		t.Fatalf("got error %v, want a mismatched issuer error", err)
+	}
+}
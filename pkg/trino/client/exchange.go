@@ -0,0 +1,145 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync"
+)
+
+// Token types of the token exchange, as described in RFC 8693.
+const (
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeIDToken     = "urn:ietf:params:oauth:token-type:id_token"
+)
+
+const tokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+// DefaultUserParam is the token exchange parameter naming the user when the
+// client token is exchanged. RFC 8693 has no such parameter, this is the
+// requested_subject extension of Keycloak.
+const DefaultUserParam = "requested_subject"
+
+// maxExchangedTokens bounds the number of users whose exchanged tokens are
+// cached.
+const maxExchangedTokens = 1000
+
+type subjectKey struct{}
+
+// Subject is the user a token is exchanged for with the token exchange.
+type Subject struct {
+	// User identifies the user, and the exchanged tokens in the cache.
+	User string
+	// Token is the token of the user, e.g. forwarded by Grafana, with its
+	// TokenType. When not set, the client token is exchanged instead, with
+	// the user in the UserParam parameter.
+	Token     string
+	TokenType string
+}
+
+// WithSubject returns a context whose requests use a token exchanged for the
+// subject, when the client has token exchange enabled.
+func WithSubject(ctx context.Context, subject Subject) context.Context {
+	return context.WithValue(ctx, subjectKey{}, subject)
+}
+
+// exchangedToken is the cached token of a user. Its lock is held while the
+// token is exchanged, so that concurrent queries of the user wait for the
+// same exchange while the queries of other users go on.
+type exchangedToken struct {
+	exchange sync.Mutex
+	// token is guarded by the lock of the client.
+	token *Token
+}
+
+// exchangeToken returns a token of the subject, exchanged at the token
+// endpoint and cached per user until it almost expires.
+func (c *Client) exchangeToken(subject Subject) (*Token, error) {
+	if subject.User == "" {
+		return nil, errors.New("token exchange requires a user")
+	}
+	entry, token := c.exchangedToken(subject.User)
+	if token != nil {
+		return token, nil
+	}
+
+	entry.exchange.Lock()
+	defer entry.exchange.Unlock()
+	// The token may have been exchanged while waiting for the lock.
+	c.lock.Lock()
+	token = entry.token
+	c.lock.Unlock()
+	if token != nil && !token.isAlmostExpired() {
+		return token, nil
+	}
+
+	values := url.Values{}
+	values.Set("grant_type", tokenExchangeGrantType)
+	values.Set("requested_token_type", TokenTypeAccessToken)
+	if subject.Token != "" {
+		values.Set("subject_token", subject.Token)
+		values.Set("subject_token_type", subject.TokenType)
+	} else {
+		clientToken, err := c.getToken()
+		if err != nil {
+			return nil, err
+		}
+		userParam := c.UserParam
+		if userParam == "" {
+			userParam = DefaultUserParam
+		}
+		values.Set("subject_token", clientToken.AccessToken)
+		values.Set("subject_token_type", TokenTypeAccessToken)
+		values.Set(userParam, subject.User)
+	}
+
+	token, err := c.requestToken(values)
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	entry.token = token
+	c.lock.Unlock()
+	return token, nil
+}
+
+// exchangedToken returns the cache entry of the user, adding it if needed,
+// and its token unless it almost expires.
+func (c *Client) exchangedToken(user string) (*exchangedToken, *Token) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry, ok := c.exchanged[user]
+	if !ok {
+		if c.exchanged == nil {
+			c.exchanged = map[string]*exchangedToken{}
+		}
+		if len(c.exchanged) >= maxExchangedTokens {
+			c.evictExchangedTokens()
+		}
+		entry = &exchangedToken{}
+		c.exchanged[user] = entry
+	}
+	if entry.token != nil && !entry.token.isAlmostExpired() {
+		return entry, entry.token
+	}
+	return entry, nil
+}
+
+// evictExchangedTokens drops the tokens that almost expire, including the
+// failed exchanges, or else the token expiring first. The lock must be held.
+func (c *Client) evictExchangedTokens() {
+	var first string
+	var firstToken *Token
+	for user, entry := range c.exchanged {
+		if entry.token == nil || entry.token.isAlmostExpired() {
+			delete(c.exchanged, user)
+			continue
+		}
+		if firstToken == nil || entry.token.ExpiresAt.Before(firstToken.ExpiresAt) {
+			first, firstToken = user, entry.token
+		}
+	}
+	if len(c.exchanged) >= maxExchangedTokens {
+		delete(c.exchanged, first)
+	}
+}
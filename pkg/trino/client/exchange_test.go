@@ -0,0 +1,237 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newExchangeServer returns a token server issuing "client-token" for the
+// client credentials grant, and "<subject>-token" for token exchanges, with
+// the token exchange requests it received.
+func newExchangeServer(t *testing.T) (*httptest.Server, func() []url.Values) {
+	var lock sync.Mutex
+	var exchanges []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("failed to parse the token request: %v", err)
+		}
+		accessToken := "client-token"
+		if r.PostForm.Get("grant_type") == tokenExchangeGrantType {
+			lock.Lock()
+			exchanges = append(exchanges, r.PostForm)
+			lock.Unlock()
+			subject := r.PostForm.Get("requested_subject")
+			if subject == "" {
+				subject = r.PostForm.Get("subject_token")
+			}
+			accessToken = subject + "-token"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"access_token": accessToken, "expires_in": 3600})
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []url.Values {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]url.Values(nil), exchanges...)
+	}
+}
+
+// newTrino returns a server recording the Authorization and X-Trino-User
+// headers of the requests.
+func newTrino(t *testing.T) (*httptest.Server, func() (string, string)) {
+	var lock sync.Mutex
+	var authorization, user string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		authorization, user = r.Header.Get("Authorization"), r.Header.Get("X-Trino-User")
+		lock.Unlock()
+	}))
+	t.Cleanup(server.Close)
+	return server, func() (string, string) {
+		lock.Lock()
+		defer lock.Unlock()
+		return authorization, user
+	}
+}
+
+func doRequest(t *testing.T, c *Client, ctx context.Context, trinoURL string) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, trinoURL+"/v1/statement", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Trino-User", "grafana")
+	response, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = response.Body.Close()
+}
+
+func TestClient_ExchangesClientTokenPerUser(t *testing.T) {
+	tokenServer, exchanges := newExchangeServer(t)
+	trino, headers := newTrino(t)
+	c := &Client{Client: http.DefaultClient, ClientId: "id", ClientSecret: "secret", Url: tokenServer.URL, TokenExchange: true}
+
+	tests := []struct {
+		user          string
+		wantExchanges int
+	}{
+		{user: "alice", wantExchanges: 1},
+		{user: "bob", wantExchanges: 2},
+		// alice's token is cached.
+		{user: "alice", wantExchanges: 2},
+	}
+	for _, tt := range tests {
+		doRequest(t, c, WithSubject(context.Background(), Subject{User: tt.user}), trino.URL)
+		authorization, user := headers()
+		if authorization != "Bearer "+tt.user+"-token" {
+			t.Errorf("got Authorization header %q for %s", authorization, tt.user)
+		}
+		if user != "" {
+			t.Errorf("got X-Trino-User header %q, want none with an exchanged token", user)
+		}
+		if got := len(exchanges()); got != tt.wantExchanges {
+			t.Errorf("got %d token exchanges after a request of %s, want %d", got, tt.user, tt.wantExchanges)
+		}
+	}
+
+	exchange := exchanges()[0]
+	want := url.Values{
+		"grant_type":           {tokenExchangeGrantType},
+		"requested_token_type": {TokenTypeAccessToken},
+		"subject_token":        {"client-token"},
+		"subject_token_type":   {TokenTypeAccessToken},
+		"requested_subject":    {"alice"},
+		"client_id":            {"id"},
+		"client_secret":        {"secret"},
+	}
+	for name, value := range want {
+		if exchange.Get(name) != value[0] {
+			t.Errorf("got %s %q, want %q", name, exchange.Get(name), value[0])
+		}
+	}
+}
+
+func TestClient_ExchangesForwardedToken(t *testing.T) {
+	tokenServer, exchanges := newExchangeServer(t)
+	trino, headers := newTrino(t)
+	c := &Client{Client: http.DefaultClient, ClientId: "id", ClientSecret: "secret", Url: tokenServer.URL, TokenExchange: true}
+
+	subject := Subject{User: "alice", Token: "alice-id", TokenType: TokenTypeIDToken}
+	doRequest(t, c, WithSubject(context.Background(), subject), trino.URL)
+	if authorization, _ := headers(); authorization != "Bearer alice-id-token" {
+		t.Errorf("got Authorization header %q", authorization)
+	}
+	exchange := exchanges()[0]
+	if exchange.Get("subject_token") != "alice-id" || exchange.Get("subject_token_type") != TokenTypeIDToken || exchange.Has("requested_subject") {
+		t.Errorf("unexpected token exchange request: %v", exchange)
+	}
+}
+
+func TestClient_UsesClientTokenWithoutSubject(t *testing.T) {
+	tokenServer, exchanges := newExchangeServer(t)
+	trino, headers := newTrino(t)
+	c := &Client{Client: http.DefaultClient, ClientId: "id", ClientSecret: "secret", Url: tokenServer.URL, TokenExchange: true}
+
+	doRequest(t, c, context.Background(), trino.URL)
+	authorization, user := headers()
+	if authorization != "Bearer client-token" || user != "grafana" {
+		t.Errorf("got Authorization header %q and X-Trino-User header %q", authorization, user)
+	}
+	if got := len(exchanges()); got != 0 {
+		t.Errorf("got %d token exchanges, want none", got)
+	}
+}
+
+func TestClient_ExchangesClientTokenWithUserParam(t *testing.T) {
+	tokenServer, exchanges := newExchangeServer(t)
+	trino, _ := newTrino(t)
+	c := &Client{Client: http.DefaultClient, ClientId: "id", ClientSecret: "secret", Url: tokenServer.URL, TokenExchange: true, UserParam: "sub"}
+
+	doRequest(t, c, WithSubject(context.Background(), Subject{User: "alice"}), trino.URL)
+	exchange := exchanges()[0]
+	if exchange.Get("sub") != "alice" || exchange.Has("requested_subject") {
+		t.Errorf("unexpected token exchange request: %v", exchange)
+	}
+}
+
+func TestClient_EvictsExchangedTokens(t *testing.T) {
+	tokenServer, _ := newExchangeServer(t)
+	c := &Client{Client: http.DefaultClient, ClientId: "id", ClientSecret: "secret", Url: tokenServer.URL, TokenExchange: true}
+	c.exchanged = map[string]*exchangedToken{}
+	for i := 0; i < maxExchangedTokens; i++ {
+		expiresAt := time.Now().Add(time.Hour + time.Duration(i)*time.Second)
+		c.exchanged["user"+strconv.Itoa(i)] = &exchangedToken{token: &Token{AccessToken: "token", ExpiresAt: expiresAt}}
+	}
+
+	if _, err := c.exchangeToken(Subject{User: "alice"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(c.exchanged) != maxExchangedTokens {
+		t.Errorf("got %d exchanged tokens, want %d", len(c.exchanged), maxExchangedTokens)
+	}
+	if _, ok := c.exchanged["user0"]; ok {
+		t.Error("the token expiring first was not evicted")
+	}
+
+	// Expired tokens are all evicted at once.
+	c.exchanged["user1"].token.ExpiresAt = time.Now()
+	c.exchanged["user2"].token.ExpiresAt = time.Now()
+	if _, err := c.exchangeToken(Subject{User: "bob"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(c.exchanged) != maxExchangedTokens-1 {
+		t.Errorf("got %d exchanged tokens, want %d", len(c.exchanged), maxExchangedTokens-1)
+	}
+	if _, ok := c.exchanged["user3"]; !ok {
+		t.Error("a valid token was evicted along with the expired ones")
+	}
+}
+
+func TestClient_ExchangesTokensConcurrently(t *testing.T) {
+	exchanging := make(chan struct{})
+	release := make(chan struct{})
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("failed to parse the token request: %v", err)
+		}
+		subject := r.PostForm.Get("requested_subject")
+		if subject == "slow" {
+			close(exchanging)
+			<-release
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"access_token": subject + "-token", "expires_in": 3600})
+	}))
+	t.Cleanup(tokenServer.Close)
+	defer close(release)
+	c := &Client{Client: http.DefaultClient, ClientId: "id", ClientSecret: "secret", Url: tokenServer.URL, TokenExchange: true}
+
+	go func() {
+		_, _ = c.exchangeToken(Subject{User: "slow"})
+	}()
+	<-exchanging
+
+	done := make(chan error)
+	go func() {
+		_, err := c.exchangeToken(Subject{User: "alice"})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the token exchange of a user waited for the one of another user")
+	}
+}
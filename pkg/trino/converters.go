@@ -0,0 +1,189 @@
+package trino
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
+	"github.com/trinodb/grafana-trino/pkg/trino/models"
+)
+
+// complexTypeConverter renders the values of an array, map or row type as
+// JSON. The driver reports these types with their parameters, e.g.
+// ARRAY(VARCHAR), which are used to render rows with named fields as
+// objects.
+func complexTypeConverter(typeName string) sqlutil.Converter {
+	prefix := strings.ToUpper(typeName) + "("
+	return sqlutil.Converter{
+		Name:          "trino " + typeName,
+		InputScanType: reflect.TypeOf((*interface{})(nil)).Elem(),
+		InputTypeMatcher: func(dbType string) bool {
+			return strings.HasPrefix(dbType, prefix)
+		},
+		FrameConverter: sqlutil.FrameConverter{
+			FieldType: data.FieldTypeNullableJSON,
+			ConvertWithColumn: func(in interface{}, col sql.ColumnType) (interface{}, error) {
+				v := *in.(*interface{})
+				if v == nil {
+					return (*json.RawMessage)(nil), nil
+				}
+				b, err := json.Marshal(jsonValue(parseTrinoType(col.DatabaseTypeName()), v))
+				if err != nil {
+					return nil, err
+				}
+				raw := json.RawMessage(b)
+				return &raw, nil
+			},
+		},
+	}
+}
+
+// decimalConverter converts decimal values, which the driver returns as
+// strings, to float64 values. With asString, the values are kept as strings
+// for tables where the float64 precision isn't enough.
+func decimalConverter(asString bool) sqlutil.Converter {
+	if asString {
+		converter := sqlutil.NullStringConverter
+		converter.Name = "trino decimal as string"
+		converter.InputTypeName = "DECIMAL"
+		return converter
+	}
+	return sqlutil.Converter{
+		Name:          "trino decimal",
+		InputScanType: reflect.TypeOf(sql.NullString{}),
+		InputTypeName: "DECIMAL",
+		FrameConverter: sqlutil.FrameConverter{
+			FieldType: data.FieldTypeNullableFloat64,
+			ConverterFunc: func(in interface{}) (interface{}, error) {
+				v := in.(*sql.NullString)
+				if !v.Valid {
+					return (*float64)(nil), nil
+				}
+				f, err := strconv.ParseFloat(v.String, 64)
+				if err != nil {
+					return nil, err
+				}
+				return &f, nil
+			},
+		},
+	}
+}
+
+// binaryConverter renders varbinary values as strings with the binary
+// encoding of the settings. The values of the sketch types, like
+// HyperLogLog, are read as varbinary values as well.
+func binaryConverter(encoding string) sqlutil.Converter {
+	encode := hex.EncodeToString
+	switch encoding {
+	case models.BinaryEncodingBase64:
+		encode = base64.StdEncoding.EncodeToString
+	case models.BinaryEncodingUTF8:
+		encode = func(b []byte) string {
+			return strings.ToValidUTF8(string(b), "\uFFFD")
+		}
+	}
+	return sqlutil.Converter{
+		Name:          "trino varbinary",
+		InputScanType: reflect.TypeOf([]byte{}),
+		InputTypeName: "VARBINARY",
+		FrameConverter: sqlutil.FrameConverter{
+			FieldType: data.FieldTypeNullableString,
+			ConverterFunc: func(in interface{}) (interface{}, error) {
+				v := *in.(*[]byte)
+				if v == nil {
+					return (*string)(nil), nil
+				}
+				s := encode(v)
+				return &s, nil
+			},
+		},
+	}
+}
+
+// stringTypeConverter reads the values of a Trino type which the driver
+// returns as strings, like uuid and ipaddress. Their fields are annotated
+// with the Trino type by applyColumnTypes.
+func stringTypeConverter(typeName string) sqlutil.Converter {
+	converter := sqlutil.NullStringConverter
+	converter.Name = "trino " + strings.ToLower(typeName)
+	converter.InputTypeName = typeName
+	return converter
+}
+
+// jsonValue converts a value of type t, as returned by the driver, to a value
+// encoding to its JSON representation. Like Trino casts to JSON, rows with
+// named fields become objects and anonymous rows become arrays.
+func jsonValue(t trinoType, v interface{}) interface{} {
+	switch value := v.(type) {
+	case []interface{}:
+		switch t.name {
+		case "array":
+			elementType := t.param(0)
+			values := make([]interface{}, len(value))
+			for i := range value {
+				values[i] = jsonValue(elementType, value[i])
+			}
+			return values
+		case "row":
+			values := make([]interface{}, len(value))
+			for i := range value {
+				values[i] = jsonValue(t.param(i), value[i])
+			}
+			if !t.namedFields() || len(t.params) != len(value) {
+				return values
+			}
+			object := jsonObject{values: values}
+			for _, param := range t.params {
+				object.keys = append(object.keys, param.field)
+			}
+			return object
+		}
+	case map[string]interface{}:
+		if t.name == "map" {
+			valueType := t.param(1)
+			values := make(map[string]interface{}, len(value))
+			for key, v := range value {
+				values[key] = jsonValue(valueType, v)
+			}
+			return values
+		}
+	}
+	return v
+}
+
+// jsonObject encodes to a JSON object keeping the order of its keys, so that
+// row fields are shown in the order of the row type.
+type jsonObject struct {
+	keys   []string
+	values []interface{}
+}
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(o.values[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,163 @@
+package trino
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
+)
+
+// queryFrame runs a query on the fake Trino server and converts the result
+// with the data source converters.
+func queryFrame(t *testing.T, s *TrinoDatasource, query string) *data.Frame {
+	t.Helper()
+	rows, err := s.db.Query(query)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer rows.Close()
+	frame, err := sqlutil.FrameFromRows(rows, -1, s.Converters()...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return frame
+}
+
+// convertResult returns the frame of a result served by a fake Trino server,
+// converted with the converters of a data source with the settings of
+// jsonData.
+func convertResult(t *testing.T, jsonData string, result fakeResult) *data.Frame {
+	t.Helper()
+	const query = "SELECT result"
+	f := newFakeTrino(t)
+	f.results[query] = result
+	return queryFrame(t, connectFake(t, f, jsonData), query)
+}
+
+func TestConverters_ComplexTypes(t *testing.T) {
+	frame := convertResult(t, `{}`, fakeResult{
+		columns: []string{"tags", "attributes", "point", "pair", "points"},
+		types: []string{
+			"array(varchar)",
+			"map(varchar, array(integer))",
+			"row(x double, label row(text varchar))",
+			"row(integer, varchar)",
+			"array(row(x integer))",
+		},
+		rows: [][]interface{}{
+			{
+				[]interface{}{"a", nil},
+				map[string]interface{}{"k": []interface{}{1, nil}},
+				[]interface{}{1.5, []interface{}{"p"}},
+				[]interface{}{1, "a"},
+				[]interface{}{[]interface{}{1}, nil},
+			},
+			{nil, nil, nil, nil, nil},
+			{
+				[]interface{}{},
+				map[string]interface{}{},
+				[]interface{}{nil, nil},
+				[]interface{}{nil, nil},
+				[]interface{}{[]interface{}{nil}},
+			},
+		},
+	})
+
+	want := [][]string{
+		{`["a",null]`, `{"k":[1,null]}`, `{"x":1.5,"label":{"text":"p"}}`, `[1,"a"]`, `[{"x":1},null]`},
+		{"", "", "", "", ""},
+		{`[]`, `{}`, `{"x":null,"label":null}`, `[null,null]`, `[{"x":null}]`},
+	}
+	for i, field := range frame.Fields {
+		if field.Type() != data.FieldTypeNullableJSON {
+			t.Errorf("%s: got field type %s, want %s", field.Name, field.Type(), data.FieldTypeNullableJSON)
+			continue
+		}
+		for row := range want {
+			var got string
+			if raw := field.At(row).(*json.RawMessage); raw != nil {
+				got = string(*raw)
+			}
+			if got != want[row][i] {
+				t.Errorf("%s row %d: got %s, want %s", field.Name, row, got, want[row][i])
+			}
+		}
+	}
+}
+
+func TestConverters_Decimal(t *testing.T) {
+	result := fakeResult{
+		columns: []string{"totalprice"},
+		types:   []string{"decimal(38,2)"},
+		rows:    [][]interface{}{{"172799.49"}, {nil}, {"12345678901234567890123456789012345.67"}},
+	}
+
+	t.Run("float64", func(t *testing.T) {
+		field := convertResult(t, `{}`, result).Fields[0]
+		if field.Type() != data.FieldTypeNullableFloat64 {
+			t.Fatalf("got field type %s, want %s", field.Type(), data.FieldTypeNullableFloat64)
+		}
+		want := []*float64{ptr(172799.49), nil, ptr(12345678901234567890123456789012345.67)}
+		for i := range want {
+			got := field.At(i).(*float64)
+			if (got == nil) != (want[i] == nil) || got != nil && *got != *want[i] {
+				t.Errorf("row %d: got %v, want %v", i, field.At(i), want[i])
+			}
+		}
+	})
+
+	t.Run("string", func(t *testing.T) {
+		field := convertResult(t, `{"decimalAsString": true}`, result).Fields[0]
+		if field.Type() != data.FieldTypeNullableString {
+			t.Fatalf("got field type %s, want %s", field.Type(), data.FieldTypeNullableString)
+		}
+		if got := *field.At(2).(*string); got != "12345678901234567890123456789012345.67" {
+			t.Errorf("got %s, want the exact value", got)
+		}
+		if got := field.At(1).(*string); got != nil {
+			t.Errorf("got %s, want NULL", *got)
+		}
+	})
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestConverters_Binary(t *testing.T) {
+	// Binary values are sent base64 encoded: "\x01\xff" and "caf\xc3\xa9\xff".
+	result := fakeResult{
+		columns: []string{"bytes", "text", "sketch"},
+		types:   []string{"varbinary", "varbinary", "HyperLogLog"},
+		rows:    [][]interface{}{{"Af8=", "Y2Fmw6n/", "AgwBAIA="}, {nil, "", nil}},
+	}
+
+	tests := []struct {
+		encoding string
+		want     []string
+	}{
+		{encoding: "hex", want: []string{"01ff", "636166c3a9ff", "020c010080"}},
+		{encoding: "base64", want: []string{"Af8=", "Y2Fmw6n/", "AgwBAIA="}},
+		{encoding: "utf8", want: []string{"\x01\uFFFD", "caf\u00e9\uFFFD", "\x02\x0c\x01\x00\uFFFD"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoding, func(t *testing.T) {
+			frame := convertResult(t, `{"binaryEncoding": "`+tt.encoding+`"}`, result)
+			for i, field := range frame.Fields {
+				if field.Type() != data.FieldTypeNullableString {
+					t.Fatalf("%s: got field type %s, want %s", field.Name, field.Type(), data.FieldTypeNullableString)
+				}
+				if got, _ := field.ConcreteAt(0); got != tt.want[i] {
+					t.Errorf("%s: got %q, want %q", field.Name, got, tt.want[i])
+				}
+			}
+			if _, ok := frame.Fields[0].ConcreteAt(1); ok {
+				t.Error("expected NULL")
+			}
+			if got, ok := frame.Fields[1].ConcreteAt(1); !ok || got != "" {
+				t.Errorf("got %v, want an empty string", got)
+			}
+		})
+	}
+}
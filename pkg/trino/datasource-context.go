@@ -3,11 +3,14 @@ package trino
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"strings"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/instancemgmt"
 	"github.com/grafana/sqlds/v4"
+	trinoClient "github.com/trinodb/grafana-trino/pkg/trino/client"
+	"github.com/trinodb/grafana-trino/pkg/trino/driver"
 	"github.com/trinodb/grafana-trino/pkg/trino/models"
 )
 
@@ -15,37 +18,79 @@ const (
 	accessTokenKey     = "accessToken"
 	trinoUserHeader    = "X-Trino-User"
 	trinoClientTagsKey = "X-Trino-Client-Tags"
+	trinoClientInfoKey = "X-Trino-Client-Info"
+	trinoSessionKey    = "X-Trino-Session"
+	trinoCatalogKey    = "X-Trino-Catalog"
+	trinoSchemaKey     = "X-Trino-Schema"
+	trinoRoleKey       = "X-Trino-Role"
+	queryResultsKey    = "queryResults"
 	bearerPrefix       = "Bearer "
 )
 
 type SQLDatasourceWithTrinoUserContext struct {
 	sqlds.SQLDatasource
+	driver sqlds.Driver
 }
 
 func (ds *SQLDatasourceWithTrinoUserContext) QueryData(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
-	config := req.PluginContext.DataSourceInstanceSettings
-	settings := models.TrinoDatasourceSettings{}
-	err := settings.Load(ctx, *config)
+	settings, err := loadSettings(ctx, req.PluginContext)
 	if err != nil {
-		return nil, fmt.Errorf("error reading settings: %s", err.Error())
+		return nil, err
 	}
 
-	ctx = injectAccessToken(ctx, req)
+	ctx, err = withTrinoContext(ctx, settings, req.PluginContext, req.GetHTTPHeaders())
+	if err != nil {
+		return nil, err
+	}
 
-	if settings.EnableImpersonation {
-		user := req.PluginContext.User
-		if user == nil {
-			return nil, fmt.Errorf("user can't be nil if impersonation is enabled")
-		}
+	// Queries are attributed to the dashboard, panel or alert rule they come
+	// from with the client info and client tags.
+	info := newClientInfo(req)
+	ctx = context.WithValue(ctx, trinoClientInfoKey, info.json())
+	ctx = context.WithValue(ctx, trinoClientTagsKey, mergeClientTags(settings.ClientTags, info))
 
-		ctx = context.WithValue(ctx, trinoUserHeader, user)
+	queries, invalid := ds.validateQueries(settings, req.Queries)
+
+	// The result columns and the state of each query are recorded by RefID,
+	// for the settings depending on the Trino types and the frame metadata.
+	results := make(map[string]*driver.Results, len(queries))
+	for _, q := range queries {
+		results[q.RefID] = &driver.Results{}
 	}
+	ctx = context.WithValue(ctx, queryResultsKey, results)
 
-	if settings.ClientTags != "" {
-		ctx = context.WithValue(ctx, trinoClientTagsKey, settings.ClientTags)
+	validReq := *req
+	validReq.Queries = queries
+	res, err := ds.SQLDatasource.QueryData(ctx, &validReq)
+	if res == nil {
+		return res, err
+	}
+	for refID, response := range res.Responses {
+		applyColumnTypes(settings, response.Frames, results[refID].Columns())
+		setQueryInfo(response.Frames, results[refID].Query())
+		setTruncationNotice(response.Frames, results[refID].Truncation())
+	}
+	for refID, response := range invalid {
+		res.Responses[refID] = response
+	}
+	return res, err
+}
+
+// CallResource serves the catalog, schema, table and column completion
+// endpoints with the same Trino user, access token and client tags as
+// QueryData.
+func (ds *SQLDatasourceWithTrinoUserContext) CallResource(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
+	settings, err := loadSettings(ctx, req.PluginContext)
+	if err != nil {
+		return err
+	}
+
+	ctx, err = withTrinoContext(ctx, settings, req.PluginContext, req.GetHTTPHeaders())
+	if err != nil {
+		return err
 	}
 
-	return ds.SQLDatasource.QueryData(ctx, req)
+	return ds.SQLDatasource.CallResource(ctx, req, sender)
 }
 
 func (ds *SQLDatasourceWithTrinoUserContext) NewDatasource(ctx context.Context, settings backend.DataSourceInstanceSettings) (instancemgmt.Instance, error) {
@@ -58,12 +103,130 @@ func (ds *SQLDatasourceWithTrinoUserContext) NewDatasource(ctx context.Context,
 
 func NewDatasource(c sqlds.Driver) *SQLDatasourceWithTrinoUserContext {
 	base := sqlds.NewDatasource(c)
-	return &SQLDatasourceWithTrinoUserContext{*base}
+	return &SQLDatasourceWithTrinoUserContext{SQLDatasource: *base, driver: c}
+}
+
+// NewInstance is the datasource instance factory. Every Grafana datasource
+// (and every revision of its settings) gets its own driver and connection
+// pool, so that instances never share state and Dispose only releases the
+// resources of the instance being disposed.
+func NewInstance(ctx context.Context, settings backend.DataSourceInstanceSettings) (instancemgmt.Instance, error) {
+	s := New()
+	ds := NewDatasource(s)
+	ds.Completable = s
+	ds.CustomRoutes = map[string]func(http.ResponseWriter, *http.Request){
+		catalogsRoute:    s.serveCatalogs,
+		columnTypesRoute: s.serveColumnTypes,
+	}
+	return ds.NewDatasource(ctx, settings)
+}
+
+// validateQueries returns the queries with a valid Trino query model and error
+// responses for the others, so that one invalid query doesn't fail the
+// whole request.
+func (ds *SQLDatasourceWithTrinoUserContext) validateQueries(settings models.TrinoDatasourceSettings, queries []backend.DataQuery) ([]backend.DataQuery, backend.Responses) {
+	valid := make([]backend.DataQuery, 0, len(queries))
+	invalid := backend.Responses{}
+	for _, q := range queries {
+		query := models.TrinoQuery{}
+		if err := query.Load(q); err != nil {
+			invalid[q.RefID] = backend.ErrDataResponseWithSource(backend.StatusBadRequest, backend.ErrorSourceDownstream, fmt.Sprintf("invalid query: %s", err.Error()))
+			continue
+		}
+		// Trino resolves a schema only in a catalog.
+		if query.Schema != "" && query.Catalog == "" && settings.DefaultCatalog == "" {
+			invalid[q.RefID] = backend.ErrDataResponseWithSource(backend.StatusBadRequest, backend.ErrorSourceDownstream, "invalid query: a schema requires a catalog, set by the query or as the data source default catalog")
+			continue
+		}
+		if settings.ReadOnly {
+			if err := ds.checkReadOnly(q); err != nil {
+				invalid[q.RefID] = backend.ErrDataResponseWithSource(backend.StatusForbidden, backend.ErrorSourceDownstream, fmt.Sprintf("query rejected: %s", err.Error()))
+				continue
+			}
+		}
+		valid = append(valid, q)
+	}
+	return valid, invalid
+}
+
+// checkReadOnly checks the query with its macros applied, as it will be sent
+// to Trino. Queries whose macros can't be applied fail when being run.
+func (ds *SQLDatasourceWithTrinoUserContext) checkReadOnly(q backend.DataQuery) error {
+	query, err := sqlds.GetQuery(q, nil, false)
+	if err != nil {
+		return nil
+	}
+	rawSQL, err := sqlds.Interpolate(ds.driver, query)
+	if err != nil {
+		return nil
+	}
+	return checkReadOnly(rawSQL)
+}
+
+func loadSettings(ctx context.Context, pluginContext backend.PluginContext) (models.TrinoDatasourceSettings, error) {
+	settings := models.TrinoDatasourceSettings{}
+	config := pluginContext.DataSourceInstanceSettings
+	if config == nil {
+		return settings, fmt.Errorf("missing data source instance settings")
+	}
+	err := settings.Load(ctx, *config)
+	if err != nil {
+		return settings, fmt.Errorf("error reading settings: %s", err.Error())
+	}
+	return settings, nil
 }
 
-func injectAccessToken(ctx context.Context, req *backend.QueryDataRequest) context.Context {
-	header := req.GetHTTPHeader(backend.OAuthIdentityTokenHeaderName)
+// withTrinoContext stores the values read by TrinoDatasource.SetQueryArgs in
+// the request context.
+func withTrinoContext(ctx context.Context, settings models.TrinoDatasourceSettings, pluginContext backend.PluginContext, headers http.Header) (context.Context, error) {
+	// Requests without a forwarded token, like alert evaluations, use the
+	// token last forwarded for the user.
+	authorization := forwardedTokens.forwardedToken(pluginContext, headers.Get(backend.OAuthIdentityTokenHeaderName))
+	ctx = injectAccessToken(ctx, authorization)
+
+	var trinoUser string
+	if settings.EnableImpersonation {
+		user := pluginContext.User
+		if user == nil {
+			return nil, fmt.Errorf("user can't be nil if impersonation is enabled")
+		}
+
+		var err error
+		trinoUser, err = mapTrinoUser(settings, user)
+		if err != nil {
+			return nil, err
+		}
+		ctx = context.WithValue(ctx, trinoUserHeader, trinoUser)
+	}
+
+	// The OAuth client exchanges a token for the user instead of sending the
+	// client token.
+	if settings.TokenExchange != "" {
+		subject, err := tokenExchangeSubject(settings, pluginContext.User, trinoUser, headers.Get(backend.OAuthIdentityIDTokenHeaderName), authorization)
+		if err != nil {
+			return nil, err
+		}
+		ctx = trinoClient.WithSubject(ctx, subject)
+	}
+
+	if settings.ClientTags != "" {
+		ctx = context.WithValue(ctx, trinoClientTagsKey, settings.ClientTags)
+	}
+
+	// The role query argument also replaces the roles of the pooled
+	// connection, so with role rules every query sets its roles.
+	if len(settings.RoleRules) > 0 {
+		roles, err := mapTrinoRoles(settings, pluginContext.User, headers)
+		if err != nil {
+			return nil, err
+		}
+		ctx = context.WithValue(ctx, trinoRoleKey, roles)
+	}
+
+	return ctx, nil
+}
 
+func injectAccessToken(ctx context.Context, header string) context.Context {
 	if strings.HasPrefix(header, bearerPrefix) {
 		token := strings.TrimPrefix(header, bearerPrefix)
 		return context.WithValue(ctx, accessTokenKey, token)
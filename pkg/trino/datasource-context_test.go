@@ -0,0 +1,828 @@
+package trino
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/instancemgmt"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const instanceQuery = "SELECT instance FROM instances"
+
+func queryDataRequest(settings backend.DataSourceInstanceSettings, rawSQL string) *backend.QueryDataRequest {
+	return &backend.QueryDataRequest{
+		PluginContext: backend.PluginContext{DataSourceInstanceSettings: &settings},
+		Queries: []backend.DataQuery{{
+			RefID: "A",
+			JSON:  []byte(fmt.Sprintf(`{"rawSql": %q, "format": 1}`, rawSQL)),
+		}},
+	}
+}
+
+// newQueryDataHandler returns the query handler of a data source instance
+// with the settings, disposed when the test ends.
+func newQueryDataHandler(t *testing.T, settings backend.DataSourceInstanceSettings) backend.QueryDataHandler {
+	t.Helper()
+	ds, err := NewInstance(context.Background(), settings)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(ds.(instancemgmt.InstanceDisposer).Dispose)
+	return ds.(backend.QueryDataHandler)
+}
+
+// queryData returns the response to the query "A" of the request, which
+// must succeed.
+func queryData(t *testing.T, handler backend.QueryDataHandler, req *backend.QueryDataRequest) backend.DataResponse {
+	t.Helper()
+	res, err := handler.QueryData(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	response := res.Responses["A"]
+	if response.Error != nil {
+		t.Fatalf("unexpected query error: %v", response.Error)
+	}
+	return response
+}
+
+// queryResult returns the response to a query whose result is served by a
+// fake Trino, on a data source instance with the settings of jsonData.
+func queryResult(t *testing.T, jsonData string, query string, result fakeResult) (*fakeTrino, backend.DataResponse) {
+	t.Helper()
+	f := newFakeTrino(t)
+	f.results[query] = result
+	settings := f.settings(jsonData)
+	return f, queryData(t, newQueryDataHandler(t, settings), queryDataRequest(settings, query))
+}
+
+func TestNewInstance_InstancesAreIsolated(t *testing.T) {
+	const instances = 5
+
+	type instance struct {
+		settings backend.DataSourceInstanceSettings
+		ds       instancemgmt.Instance
+	}
+	created := make([]instance, instances)
+	for i := range created {
+		f := newFakeTrino(t)
+		f.results[instanceQuery] = fakeResult{
+			columns: []string{"instance"},
+			types:   []string{"bigint"},
+			rows:    [][]interface{}{{i}},
+		}
+		settings := f.settings(`{}`)
+		settings.UID = fmt.Sprintf("trino-%d", i)
+		ds, err := NewInstance(context.Background(), settings)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		t.Cleanup(ds.(instancemgmt.InstanceDisposer).Dispose)
+		created[i] = instance{settings: settings, ds: ds}
+	}
+
+	var wg sync.WaitGroup
+	for i, inst := range created {
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				handler := inst.ds.(backend.QueryDataHandler)
+				res, err := handler.QueryData(context.Background(), queryDataRequest(inst.settings, instanceQuery))
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+					return
+				}
+				response := res.Responses["A"]
+				if response.Error != nil {
+					t.Errorf("unexpected query error: %v", response.Error)
+					return
+				}
+				got, ok := response.Frames[0].Fields[0].ConcreteAt(0)
+				if !ok || got != int64(i) {
+					t.Errorf("instance %d got a result from instance %v", i, got)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+}
+
+func TestNewInstance_DisposeOnlyClosesItsOwnConnections(t *testing.T) {
+	first, second := newFakeTrino(t), newFakeTrino(t)
+	second.results[instanceQuery] = fakeResult{
+		columns: []string{"instance"},
+		types:   []string{"bigint"},
+		rows:    [][]interface{}{{2}},
+	}
+
+	firstSettings, secondSettings := first.settings(`{}`), second.settings(`{}`)
+	firstSettings.UID, secondSettings.UID = "first", "second"
+	firstDs, err := NewInstance(context.Background(), firstSettings)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	secondDs, err := NewInstance(context.Background(), secondSettings)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(secondDs.(instancemgmt.InstanceDisposer).Dispose)
+
+	firstDs.(instancemgmt.InstanceDisposer).Dispose()
+
+	res, err := secondDs.(backend.QueryDataHandler).QueryData(context.Background(), queryDataRequest(secondSettings, instanceQuery))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := res.Responses["A"].Error; err != nil {
+		t.Fatalf("query on the remaining instance failed: %v", err)
+	}
+}
+
+func sessionProperties(header http.Header) []string {
+	var properties []string
+	for _, value := range header.Values(trinoSessionKey) {
+		properties = append(properties, strings.Split(value, ",")...)
+	}
+	sort.Strings(properties)
+	return properties
+}
+
+func TestQueryData_SessionProperties(t *testing.T) {
+	f := newFakeTrino(t)
+	settings := f.settings(`{"sessionProperties": {"query_max_execution_time": "1h", "hive.parquet_use_column_names": "true"}}`)
+	handler := newQueryDataHandler(t, settings)
+
+	t.Run("data source properties", func(t *testing.T) {
+		if _, err := handler.QueryData(context.Background(), queryDataRequest(settings, "SELECT 1")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := []string{"hive.parquet_use_column_names=true", "query_max_execution_time=1h"}
+		if got := sessionProperties(f.lastHeader()); !reflect.DeepEqual(got, want) {
+			t.Errorf("got session properties %v, want %v", got, want)
+		}
+	})
+
+	t.Run("query properties override data source properties", func(t *testing.T) {
+		req := queryDataRequest(settings, "SELECT 1")
+		req.Queries[0].JSON = []byte(`{"rawSql": "SELECT 1", "format": 1, "sessionProperties": {"query_max_execution_time": "5m", "join_distribution_type": "BROADCAST"}}`)
+		if _, err := handler.QueryData(context.Background(), req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := []string{"hive.parquet_use_column_names=true", "join_distribution_type=BROADCAST", "query_max_execution_time=5m"}
+		if got := sessionProperties(f.lastHeader()); !reflect.DeepEqual(got, want) {
+			t.Errorf("got session properties %v, want %v", got, want)
+		}
+	})
+
+	t.Run("invalid query properties fail only that query", func(t *testing.T) {
+		req := queryDataRequest(settings, "SELECT 1")
+		req.Queries = append(req.Queries, backend.DataQuery{
+			RefID: "B",
+			JSON:  []byte(`{"rawSql": "SELECT 1", "sessionProperties": {"bad,name": "x"}}`),
+		})
+		res, err := handler.QueryData(context.Background(), req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := res.Responses["A"].Error; err != nil {
+			t.Errorf("unexpected error for the valid query: %v", err)
+		}
+		if res.Responses["B"].Error == nil {
+			t.Error("expected an error for the query with an invalid session property")
+		}
+	})
+}
+
+func TestQueryData_CatalogAndSchema(t *testing.T) {
+	f := newFakeTrino(t)
+	settings := f.settings(`{"defaultCatalog": "tpch", "defaultSchema": "tiny"}`)
+	handler := newQueryDataHandler(t, settings)
+
+	tests := []struct {
+		name        string
+		query       string
+		wantCatalog string
+		wantSchema  string
+	}{
+		{name: "data source defaults", query: `{"rawSql": "SELECT 1"}`, wantCatalog: "tpch", wantSchema: "tiny"},
+		{name: "query schema", query: `{"rawSql": "SELECT 1", "schema": "sf1"}`, wantCatalog: "tpch", wantSchema: "sf1"},
+		{name: "query catalog and schema", query: `{"rawSql": "SELECT 1", "catalog": "hive", "schema": "web"}`, wantCatalog: "hive", wantSchema: "web"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := queryDataRequest(settings, "")
+			req.Queries[0].JSON = []byte(tt.query)
+			if _, err := handler.QueryData(context.Background(), req); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			header := f.lastHeader()
+			if got := header.Get(trinoCatalogKey); got != tt.wantCatalog {
+				t.Errorf("got catalog %q, want %q", got, tt.wantCatalog)
+			}
+			if got := header.Get(trinoSchemaKey); got != tt.wantSchema {
+				t.Errorf("got schema %q, want %q", got, tt.wantSchema)
+			}
+		})
+	}
+
+	t.Run("query schema without a catalog", func(t *testing.T) {
+		settings := f.settings(`{}`)
+		req := queryDataRequest(settings, "")
+		req.Queries[0].JSON = []byte(`{"rawSql": "SELECT 1", "schema": "sf1"}`)
+		res, err := newQueryDataHandler(t, settings).QueryData(context.Background(), req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := res.Responses["A"].Error; err == nil || !strings.Contains(err.Error(), "a schema requires a catalog") {
+			t.Errorf("got error %v, want a missing catalog error", err)
+		}
+	})
+}
+
+func TestQueryData_ImpersonatesMappedUser(t *testing.T) {
+	f := newFakeTrino(t)
+	settings := f.settings(`{"enableImpersonation": true, "userMapping": "emailLocalPart"}`)
+	handler := newQueryDataHandler(t, settings)
+
+	req := queryDataRequest(settings, "SELECT 1")
+	req.PluginContext.User = &backend.User{Login: "alice", Email: "asmith@example.com"}
+	if _, err := handler.QueryData(context.Background(), req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := f.lastHeader().Get(trinoUserHeader); got != "asmith" {
+		t.Errorf("got Trino user %q, want %q", got, "asmith")
+	}
+
+	req.PluginContext.User = &backend.User{Login: "sa-1-dashboards"}
+	if _, err := handler.QueryData(context.Background(), req); err == nil {
+		t.Error("expected an error for a user without an email")
+	}
+}
+
+func TestQueryData_ClientInfo(t *testing.T) {
+	f := newFakeTrino(t)
+	settings := f.settings(`{"clientTags": "team-a, grafana:dashboard"}`)
+	handler := newQueryDataHandler(t, settings)
+
+	for _, tt := range []struct {
+		name     string
+		headers  map[string]string
+		wantInfo string
+		wantTags string
+	}{
+		{
+			name:     "dashboard",
+			headers:  map[string]string{"http_" + dashboardUIDHeader: "sales", "http_" + panelIDHeader: "4"},
+			wantInfo: `{"requestType":"dashboard","orgId":2,"dashboardUid":"sales","panelId":"4"}`,
+			wantTags: "team-a,grafana:dashboard,org:2,dashboard:sales,panel:4",
+		},
+		{
+			name:     "alert",
+			headers:  map[string]string{backend.FromAlertHeaderName: "true", ruleUIDHeader: "rule-1"},
+			wantInfo: `{"requestType":"alert","orgId":2,"alertRuleUid":"rule-1"}`,
+			wantTags: "team-a,grafana:dashboard,grafana:alert,org:2,alert-rule:rule-1",
+		},
+		{
+			name:     "explore",
+			wantInfo: `{"requestType":"explore","orgId":2}`,
+			wantTags: "team-a,grafana:dashboard,grafana:explore,org:2",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := queryDataRequest(settings, "SELECT 1")
+			req.PluginContext.OrgID = 2
+			req.Headers = tt.headers
+			if _, err := handler.QueryData(context.Background(), req); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			header := f.lastHeader()
+			if got := header.Get(trinoClientInfoKey); got != tt.wantInfo {
+				t.Errorf("got client info %s, want %s", got, tt.wantInfo)
+			}
+			if got := header.Get(trinoClientTagsKey); got != tt.wantTags {
+				t.Errorf("got client tags %q, want %q", got, tt.wantTags)
+			}
+		})
+	}
+}
+
+func TestQueryData_RolesPerUser(t *testing.T) {
+	f := newFakeTrino(t)
+	settings := f.settings(`{"roles": "system:reader", "roleRules": [{"orgRole": "Admin", "roles": "system:admin"}]}`)
+	handler := newQueryDataHandler(t, settings)
+
+	// Alternate users so that pooled connections are reused across them.
+	for _, tt := range []struct {
+		role string
+		want string
+	}{
+		{role: "Admin", want: "system=ROLE{admin}"},
+		{role: "Viewer", want: "system=ROLE{reader}"},
+		{role: "Admin", want: "system=ROLE{admin}"},
+		{role: "Viewer", want: "system=ROLE{reader}"},
+	} {
+		req := queryDataRequest(settings, "SELECT 1")
+		req.PluginContext.User = &backend.User{Login: "user", Role: tt.role}
+		if _, err := handler.QueryData(context.Background(), req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := f.lastHeader().Get(trinoRoleKey); got != tt.want {
+			t.Errorf("%s got roles %q, want %q", tt.role, got, tt.want)
+		}
+	}
+}
+
+func TestQueryData_AlertExchangesForwardedToken(t *testing.T) {
+	// The token server exchanges "<token>" for "<token>-exchanged", and
+	// issues exchanged tokens that are always almost expired, so that every
+	// query exchanges a token.
+	var lock sync.Mutex
+	var subjectTokens []string
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("failed to parse the token request: %v", err)
+		}
+		lock.Lock()
+		subjectTokens = append(subjectTokens, r.PostForm.Get("subject_token"))
+		lock.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"access_token": r.PostForm.Get("subject_token") + "-exchanged"})
+	}))
+	t.Cleanup(tokenServer.Close)
+
+	f := newFakeTrino(t)
+	settings := f.settings(fmt.Sprintf(`{"tokenUrl": %q, "clientId": "grafana", "tokenExchange": "forwarded"}`, tokenServer.URL))
+	settings.UID = "forwarded-exchange"
+	settings.DecryptedSecureJSONData = map[string]string{"clientSecret": "secret"}
+	handler := newQueryDataHandler(t, settings)
+
+	for _, tt := range []struct {
+		name    string
+		headers map[string]string
+	}{
+		{name: "dashboard", headers: map[string]string{backend.OAuthIdentityTokenHeaderName: "Bearer alice-token"}},
+		// Grafana forwards no token for alert evaluations.
+		{name: "alert", headers: map[string]string{backend.FromAlertHeaderName: "true"}},
+	} {
+		req := queryDataRequest(settings, "SELECT 1")
+		req.PluginContext.User = &backend.User{Login: "alice"}
+		req.Headers = tt.headers
+		resp, err := handler.QueryData(context.Background(), req)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		if err := resp.Responses["A"].Error; err != nil {
+			t.Fatalf("%s: unexpected query error: %v", tt.name, err)
+		}
+		if got := f.lastHeader().Get("Authorization"); got != "Bearer alice-token-exchanged" {
+			t.Errorf("%s: got Authorization header %q, want the exchanged token of alice", tt.name, got)
+		}
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	for _, token := range subjectTokens {
+		if token != "alice-token" {
+			t.Errorf("got subject token %q, want the forwarded token of alice", token)
+		}
+	}
+}
+
+func TestQueryData_ReadOnly(t *testing.T) {
+	f := newFakeTrino(t)
+	settings := f.settings(`{"readOnly": true}`)
+	handler := newQueryDataHandler(t, settings)
+
+	req := queryDataRequest(settings, "SELECT orderdate FROM orders WHERE $__timeFilter(orderdate)")
+	req.Queries = append(req.Queries, backend.DataQuery{
+		RefID: "B",
+		JSON:  []byte(`{"rawSql": "SELECT 1; DROP TABLE orders"}`),
+	})
+	res, err := handler.QueryData(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := res.Responses["A"].Error; err != nil {
+		t.Errorf("unexpected error for the read-only query: %v", err)
+	}
+	if res.Responses["B"].Error == nil {
+		t.Error("expected the multi-statement query to be rejected")
+	}
+	for _, query := range f.queries {
+		if strings.Contains(query, "DROP") {
+			t.Errorf("rejected query was sent to Trino: %q", query)
+		}
+	}
+}
+
+func TestQueryData_FlattenRows(t *testing.T) {
+	const query = "SELECT id, point FROM points"
+	_, response := queryResult(t, `{"flattenRows": true}`, query, fakeResult{
+		columns: []string{"id", "point"},
+		types:   []string{"bigint", "row(x double, visible boolean, label row(text varchar, tags array(varchar)))"},
+		rows: [][]interface{}{
+			{1, []interface{}{1.5, true, []interface{}{"a", []interface{}{"t"}}}},
+			{2, nil},
+			{3, []interface{}{"NaN", nil, nil}},
+		},
+	})
+
+	frame := response.Frames[0]
+	want := []struct {
+		name   string
+		values []string
+	}{
+		{name: "id", values: []string{"1", "2", "3"}},
+		{name: "point.x", values: []string{"1.5", "null", "NaN"}},
+		{name: "point.visible", values: []string{"true", "null", "null"}},
+		{name: "point.label.text", values: []string{"a", "null", "null"}},
+		{name: "point.label.tags", values: []string{`["t"]`, "null", "null"}},
+	}
+	if len(frame.Fields) != len(want) {
+		t.Fatalf("got %d fields, want %d", len(frame.Fields), len(want))
+	}
+	for i, field := range frame.Fields {
+		if field.Name != want[i].name {
+			t.Errorf("got field %q, want %q", field.Name, want[i].name)
+		}
+		for row, wantValue := range want[i].values {
+			got := "null"
+			if v, ok := field.ConcreteAt(row); ok {
+				if raw, isJSON := v.(json.RawMessage); isJSON {
+					got = string(raw)
+				} else {
+					got = fmt.Sprint(v)
+				}
+			}
+			if got != wantValue {
+				t.Errorf("%s row %d: got %s, want %s", field.Name, row, got, wantValue)
+			}
+		}
+	}
+}
+
+func TestQueryData_DecimalFieldConfig(t *testing.T) {
+	const query = "SELECT sum(totalprice) AS total FROM orders"
+	_, response := queryResult(t, `{}`, query, fakeResult{
+		columns: []string{"total"},
+		types:   []string{"decimal(12,2)"},
+		rows:    [][]interface{}{{"1234.50"}},
+	})
+
+	field := response.Frames[0].Fields[0]
+	if got, _ := field.ConcreteAt(0); got != 1234.5 {
+		t.Errorf("got value %v, want 1234.5", got)
+	}
+	config := field.Config
+	if config == nil || config.Decimals == nil || *config.Decimals != 2 {
+		t.Fatalf("got config %+v, want 2 decimals", config)
+	}
+	if config.Custom["precision"] != int64(12) || config.Custom["scale"] != int64(2) {
+		t.Errorf("got custom config %v, want precision 12 and scale 2", config.Custom)
+	}
+}
+
+func TestQueryData_IntervalUnit(t *testing.T) {
+	f := newFakeTrino(t)
+	const query = "SELECT max(finished - started) AS elapsed FROM jobs"
+	f.results[query] = fakeResult{
+		columns: []string{"elapsed"},
+		types:   []string{"interval day to second"},
+		rows:    [][]interface{}{{"0 00:00:02.000"}},
+	}
+
+	for _, tt := range []struct {
+		jsonData string
+		wantUnit string
+	}{
+		{jsonData: `{}`, wantUnit: "ms"},
+		{jsonData: `{"intervalAsString": true}`, wantUnit: ""},
+	} {
+		settings := f.settings(tt.jsonData)
+		response := queryData(t, newQueryDataHandler(t, settings), queryDataRequest(settings, query))
+		var unit string
+		if config := response.Frames[0].Fields[0].Config; config != nil {
+			unit = config.Unit
+		}
+		if unit != tt.wantUnit {
+			t.Errorf("%s: got unit %q, want %q", tt.jsonData, unit, tt.wantUnit)
+		}
+	}
+}
+
+func TestQueryData_Geometries(t *testing.T) {
+	const query = "SELECT name, location, area FROM places"
+	_, response := queryResult(t, `{}`, query, fakeResult{
+		columns: []string{"name", "location", "area"},
+		types:   []string{"varchar", "Geometry", "SphericalGeography"},
+		rows: [][]interface{}{
+			{"a", "POINT (21.01 52.23)", "POLYGON ((0 0, 1 0, 1 1, 0 0))"},
+			{"b", nil, "POINT (1 2)"},
+			{"c", "POINT EMPTY", nil},
+		},
+	})
+
+	frame := response.Frames[0]
+	want := []struct {
+		name      string
+		trinoType string
+		values    []string
+	}{
+		{name: "name", trinoType: "varchar", values: []string{"a", "b", "c"}},
+		// The point fields keep the config of their column.
+		{name: "latitude", trinoType: "Geometry", values: []string{"52.23", "null", "null"}},
+		{name: "longitude", trinoType: "Geometry", values: []string{"21.01", "null", "null"}},
+		{name: "area", trinoType: "SphericalGeography", values: []string{
+			`{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,0]]]}`,
+			`{"type":"Point","coordinates":[1,2]}`,
+			"null",
+		}},
+	}
+	if len(frame.Fields) != len(want) {
+		t.Fatalf("got %d fields, want %d", len(frame.Fields), len(want))
+	}
+	for i, field := range frame.Fields {
+		if field.Name != want[i].name {
+			t.Errorf("got field %q, want %q", field.Name, want[i].name)
+		}
+		if field.Config == nil || field.Config.Custom["trinoType"] != want[i].trinoType {
+			t.Errorf("%s: got field config %+v, want Trino type %q", field.Name, field.Config, want[i].trinoType)
+		}
+		for row, wantValue := range want[i].values {
+			got := "null"
+			if v, ok := field.ConcreteAt(row); ok {
+				got = fmt.Sprint(v)
+			}
+			if got != wantValue {
+				t.Errorf("%s row %d: got %s, want %s", field.Name, row, got, wantValue)
+			}
+		}
+	}
+}
+
+func TestQueryData_StringTypeAnnotations(t *testing.T) {
+	const query = "SELECT id, source, network, name FROM flows"
+	_, response := queryResult(t, `{}`, query, fakeResult{
+		columns: []string{"id", "source", "network", "name"},
+		types:   []string{"uuid", "ipaddress", "ipprefix", "varchar"},
+		rows: [][]interface{}{
+			{"12151fd2-7586-11e9-8f9e-2a86e4085a59", "10.0.0.1", "10.0.0.0/8", "a"},
+			{nil, nil, nil, nil},
+		},
+	})
+
+	want := []struct {
+		value     string
+		trinoType interface{}
+	}{
+		{value: "12151fd2-7586-11e9-8f9e-2a86e4085a59", trinoType: "uuid"},
+		{value: "10.0.0.1", trinoType: "ipaddress"},
+		{value: "10.0.0.0/8", trinoType: "ipprefix"},
+		{value: "a", trinoType: "varchar"},
+	}
+	for i, field := range response.Frames[0].Fields {
+		if field.Type() != data.FieldTypeNullableString {
+			t.Errorf("%s: got field type %s, want a nullable string", field.Name, field.Type())
+		}
+		if got, _ := field.ConcreteAt(0); got != want[i].value {
+			t.Errorf("%s: got value %v, want %s", field.Name, got, want[i].value)
+		}
+		if _, ok := field.ConcreteAt(1); ok {
+			t.Errorf("%s: got a value, want null", field.Name)
+		}
+		var trinoType interface{}
+		if field.Config != nil {
+			trinoType = field.Config.Custom["trinoType"]
+		}
+		if trinoType != want[i].trinoType {
+			t.Errorf("%s: got Trino type %v, want %v", field.Name, trinoType, want[i].trinoType)
+		}
+	}
+}
+
+func TestQueryData_TrinoTypes(t *testing.T) {
+	const query = "SELECT code, total, created, tags, point FROM orders"
+	types := []string{"varchar(10)", "decimal(12,2)", "timestamp(3) with time zone", "array(varchar)", "row(x double, y double)"}
+	_, response := queryResult(t, `{}`, query, fakeResult{
+		columns: []string{"code", "total", "created", "tags", "point"},
+		types:   types,
+		rows:    [][]interface{}{{"a", "1.50", "2024-03-01 12:30:00.123 UTC", []interface{}{"t"}, []interface{}{1.5, 2}}},
+	})
+
+	for i, field := range response.Frames[0].Fields {
+		var trinoType interface{}
+		if field.Config != nil {
+			trinoType = field.Config.Custom["trinoType"]
+		}
+		if trinoType != types[i] {
+			t.Errorf("%s: got Trino type %v, want %s", field.Name, trinoType, types[i])
+		}
+	}
+}
+
+func TestQueryData_QueryInfo(t *testing.T) {
+	const query = "SELECT 1"
+	f, response := queryResult(t, `{}`, query, fakeResult{
+		columns: []string{"_col0"},
+		types:   []string{"integer"},
+		rows:    [][]interface{}{{1}},
+		stats: map[string]interface{}{
+			"queuedTimeMillis":  5,
+			"elapsedTimeMillis": 120,
+			"cpuTimeMillis":     40,
+			"processedRows":     1000,
+			"processedBytes":    2048,
+			"peakMemoryBytes":   4096,
+		},
+	})
+
+	meta := response.Frames[0].Meta
+	wantCustom := map[string]interface{}{
+		"queryId":    "query",
+		"queryUrl":   f.URL + "/ui/query.html?query",
+		"queryState": "FINISHED",
+	}
+	if !reflect.DeepEqual(meta.Custom, wantCustom) {
+		t.Errorf("got custom metadata %v, want %v", meta.Custom, wantCustom)
+	}
+	if meta.ExecutedQueryString != query {
+		t.Errorf("got executed query %q, want %q", meta.ExecutedQueryString, query)
+	}
+	wantNotices := []data.Notice{{Severity: data.NoticeSeverityInfo, Text: "Trino query query", Link: f.URL + "/ui/query.html?query"}}
+	if !reflect.DeepEqual(meta.Notices, wantNotices) {
+		t.Errorf("got notices %v, want %v", meta.Notices, wantNotices)
+	}
+
+	want := map[string]float64{
+		"Queued time":     5,
+		"Elapsed time":    120,
+		"CPU time":        40,
+		"Processed rows":  1000,
+		"Processed bytes": 2048,
+		"Peak memory":     4096,
+	}
+	got := map[string]float64{}
+	for _, stat := range meta.Stats {
+		got[stat.DisplayName] = stat.Value
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got stats %v, want %v", got, want)
+	}
+}
+
+func TestQueryData_CancelsQueries(t *testing.T) {
+	f := newFakeTrino(t)
+	const query = "SELECT * FROM slow"
+	f.results[query] = fakeResult{running: true}
+	settings := f.settings(`{}`)
+	handler := newQueryDataHandler(t, settings)
+
+	t.Run("query timeout", func(t *testing.T) {
+		req := queryDataRequest(settings, query)
+		req.Queries[0].JSON = []byte(fmt.Sprintf(`{"rawSql": %q, "format": 1, "timeout": 1}`, query))
+		start := time.Now()
+		res, err := handler.QueryData(context.Background(), req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if res.Responses["A"].Error == nil {
+			t.Error("expected a timeout error")
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("query ran for %s, want a timeout after 1s", elapsed)
+		}
+		f.waitForDelete(t, f.URL+"/v1/statement/executing/0?page=1")
+	})
+
+	t.Run("canceled request", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		res, err := handler.QueryData(ctx, queryDataRequest(settings, query))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if res.Responses["A"].Error == nil {
+			t.Error("expected a cancellation error")
+		}
+		f.waitForDelete(t, f.URL+"/v1/statement/executing/1?page=1")
+	})
+}
+
+func TestQueryData_ResultLimits(t *testing.T) {
+	f := newFakeTrino(t)
+	const query = "SELECT name FROM events"
+	f.results[query] = fakeResult{
+		columns:  []string{"name"},
+		types:    []string{"varchar"},
+		rows:     [][]interface{}{{"aaaa"}, {"bbbb"}, {"cccc"}, {"dddd"}, {"eeee"}, {"ffff"}},
+		pageSize: 2,
+	}
+
+	for _, tt := range []struct {
+		name       string
+		jsonData   string
+		queryJSON  string
+		wantRows   int
+		wantNotice string
+	}{
+		{name: "no limits", jsonData: `{}`, wantRows: 6},
+		{name: "limit not reached", jsonData: `{"maxRows": 7}`, wantRows: 6},
+		{name: "limit reached", jsonData: `{"maxRows": 6}`, wantRows: 6},
+		{name: "one row over the limit", jsonData: `{"maxRows": 5}`, wantRows: 5, wantNotice: "Results were limited to the first 5 rows."},
+		{name: "row limit", jsonData: `{"maxRows": 3}`, wantRows: 3, wantNotice: "Results were limited to the first 3 rows."},
+		{name: "byte limit", jsonData: `{"maxResultBytes": 10}`, wantRows: 2, wantNotice: "Results were truncated to the first 2 rows, within the limit of 10 bytes."},
+		{name: "first row over the byte limit", jsonData: `{"maxResultBytes": 3}`, wantRows: 0, wantNotice: "Results were truncated to no rows, as the first row has an estimated size of 4 bytes, more than the limit of 3 bytes."},
+		{name: "query override", jsonData: `{"maxRows": 3}`, queryJSON: `"maxRows": 5,`, wantRows: 5, wantNotice: "Results were limited to the first 5 rows."},
+		{name: "ceiling", jsonData: `{"maxRows": 3, "maxRowsCeiling": 4}`, queryJSON: `"maxRows": 5,`, wantRows: 4, wantNotice: "Results were limited to the first 4 rows."},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := f.settings(tt.jsonData)
+			req := queryDataRequest(settings, query)
+			req.Queries[0].JSON = []byte(fmt.Sprintf(`{%s "rawSql": %q, "format": 1}`, tt.queryJSON, query))
+			frame := queryData(t, newQueryDataHandler(t, settings), req).Frames[0]
+			if rows, _ := frame.RowLen(); rows != tt.wantRows {
+				t.Errorf("got %d rows, want %d", rows, tt.wantRows)
+			}
+			var notices []string
+			for _, notice := range frame.Meta.Notices {
+				if notice.Severity == data.NoticeSeverityWarning {
+					notices = append(notices, notice.Text)
+				}
+			}
+			switch {
+			case tt.wantNotice == "" && len(notices) != 0:
+				t.Errorf("got notices %v, want none", notices)
+			case tt.wantNotice != "" && !reflect.DeepEqual(notices, []string{tt.wantNotice}):
+				t.Errorf("got notices %v, want %q", notices, tt.wantNotice)
+			}
+		})
+	}
+}
+
+func TestQueryData_ResultLimitStopsQuery(t *testing.T) {
+	const query = "SELECT name FROM events"
+	f, response := queryResult(t, `{"maxRows": 2}`, query, fakeResult{
+		columns: []string{"name"},
+		types:   []string{"varchar"},
+		rows:    [][]interface{}{{"a"}, {"b"}, {"c"}},
+		running: true,
+	})
+	if rows, _ := response.Frames[0].RowLen(); rows != 2 {
+		t.Errorf("got %d rows, want 2", rows)
+	}
+	f.waitForDelete(t, f.URL+"/v1/statement/executing/0?page=1")
+}
+
+func TestCallResource_Catalogs(t *testing.T) {
+	f := newFakeTrino(t)
+	f.results["SHOW CATALOGS"] = fakeResult{
+		columns: []string{"Catalog"},
+		types:   []string{"varchar"},
+		rows:    [][]interface{}{{"hive"}, {"tpch"}},
+	}
+	// The schemas endpoint lists the schemas of the default catalog.
+	settings := f.settings(`{"defaultCatalog": "tpch"}`)
+	ds, err := NewInstance(context.Background(), settings)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(ds.(instancemgmt.InstanceDisposer).Dispose)
+
+	var response *backend.CallResourceResponse
+	req := &backend.CallResourceRequest{
+		PluginContext: backend.PluginContext{DataSourceInstanceSettings: &settings},
+		Path:          "catalogs",
+		Method:        http.MethodPost,
+		URL:           "catalogs",
+	}
+	err = ds.(backend.CallResourceHandler).CallResource(context.Background(), req, backend.CallResourceResponseSenderFunc(func(res *backend.CallResourceResponse) error {
+		response = res
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if response == nil || response.Status != http.StatusOK {
+		t.Fatalf("got response %+v, want the catalogs", response)
+	}
+	var catalogs []string
+	if err := json.Unmarshal(response.Body, &catalogs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"hive", "tpch"}; !reflect.DeepEqual(catalogs, want) {
+		t.Errorf("got catalogs %v, want %v", catalogs, want)
+	}
+}
@@ -4,9 +4,14 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"regexp"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
@@ -16,13 +21,29 @@ import (
 	"github.com/trinodb/grafana-trino/pkg/trino/models"
 )
 
+const (
+	catalogOption = "catalog"
+	schemaOption  = "schema"
+	tableOption   = "table"
+)
+
+// catalogsRoute and columnTypesRoute are the completion endpoints listing the
+// catalogs and the columns of a table with their types, next to the schemas,
+// tables and columns endpoints of sqlds.
+const (
+	catalogsRoute    = "/catalogs"
+	columnTypesRoute = "/column-types"
+)
+
 type TrinoDatasource struct {
-	db *sql.DB
+	db       *sql.DB
+	settings models.TrinoDatasourceSettings
 }
 
 var (
 	_ sqlds.Driver         = (*TrinoDatasource)(nil)
 	_ sqlds.QueryArgSetter = (*TrinoDatasource)(nil)
+	_ sqlds.QueryMutator   = (*TrinoDatasource)(nil)
 	_ sqlds.Completable    = (*TrinoDatasource)(nil)
 )
 
@@ -51,13 +72,14 @@ func (s *TrinoDatasource) Connect(ctx context.Context, config backend.DataSource
 		return nil, fmt.Errorf("failed to connect to database. Is the hostname and port correct?: %w", err)
 	}
 	s.db = db
+	s.settings = settings
 
 	return db, nil
 }
 
 func (s *TrinoDatasource) Converters() (sc []sqlutil.Converter) {
 	nullStringConverter := sqlutil.NullStringConverter
-	nullStringConverter.InputTypeRegex = regexp.MustCompile("char|varchar|varbinary|json|interval year to month|interval day to second|decimal|ipaddress|unknown")
+	nullStringConverter.InputTypeRegex = regexp.MustCompile("char|varchar|json|interval year to month|interval day to second|unknown")
 	nullDecimalConverter := sqlutil.NullDecimalConverter
 	nullDecimalConverter.InputTypeRegex = regexp.MustCompile("real|double")
 	nullInt64Converter := sqlutil.NullInt64Converter
@@ -67,6 +89,20 @@ func (s *TrinoDatasource) Converters() (sc []sqlutil.Converter) {
 	nullBoolConverter := sqlutil.NullBoolConverter
 	nullBoolConverter.InputTypeName = "boolean"
 	return []sqlutil.Converter{
+		complexTypeConverter("array"),
+		complexTypeConverter("map"),
+		complexTypeConverter("row"),
+		decimalConverter(s.settings.DecimalAsString),
+		timestampConverter("DATE"),
+		timestampConverter("TIMESTAMP"),
+		timestampConverter("TIMESTAMP WITH TIME ZONE"),
+		intervalConverter(intervalDayToSecond, s.settings.IntervalAsString),
+		intervalConverter(intervalYearToMonth, s.settings.IntervalAsString),
+		binaryConverter(s.settings.BinaryEncoding),
+		geometryConverter("GEOMETRY"),
+		geometryConverter("SPHERICALGEOGRAPHY"),
+		stringTypeConverter("UUID"),
+		stringTypeConverter("IPADDRESS"),
 		nullStringConverter,
 		nullDecimalConverter,
 		nullInt64Converter,
@@ -75,15 +111,78 @@ func (s *TrinoDatasource) Converters() (sc []sqlutil.Converter) {
 	}
 }
 
+// MutateQuery stores the Trino specific fields of the query model in the
+// context, for SetQueryArgs, its timeout and result limits, and where to
+// record its results.
+// The query model was validated by QueryData.
+func (s *TrinoDatasource) MutateQuery(ctx context.Context, req backend.DataQuery) (context.Context, backend.DataQuery) {
+	if results, ok := ctx.Value(queryResultsKey).(map[string]*driver.Results); ok {
+		ctx = driver.WithResults(ctx, results[req.RefID])
+	}
+
+	query := models.TrinoQuery{}
+	if err := query.Load(req); err != nil {
+		return ctx, req
+	}
+
+	if len(query.SessionProperties) > 0 {
+		ctx = context.WithValue(ctx, trinoSessionKey, query.SessionProperties)
+	}
+
+	if query.Catalog != "" {
+		ctx = context.WithValue(ctx, trinoCatalogKey, query.Catalog)
+	}
+
+	if query.Schema != "" {
+		ctx = context.WithValue(ctx, trinoSchemaKey, query.Schema)
+	}
+
+	timeout := s.settings.QueryTimeout
+	if query.Timeout > 0 {
+		timeout = query.Timeout
+	}
+	if timeout > 0 {
+		ctx = driver.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	}
+
+	limits := driver.Limits{
+		Rows:  resultLimit(query.MaxRows, s.settings.MaxRows, s.settings.MaxRowsCeiling),
+		Bytes: resultLimit(query.MaxResultBytes, s.settings.MaxResultBytes, s.settings.MaxResultBytesCeiling),
+	}
+	if limits != (driver.Limits{}) {
+		ctx = driver.WithLimits(ctx, limits)
+	}
+
+	return ctx, req
+}
+
+// resultLimit returns the limit of the query, or else the data source limit,
+// capped by the ceiling. Zero means no limit.
+func resultLimit(query, datasource, ceiling int64) int64 {
+	limit := datasource
+	if query > 0 {
+		limit = query
+	}
+	if ceiling > 0 && (limit == 0 || limit > ceiling) {
+		limit = ceiling
+	}
+	return limit
+}
+
 func (s *TrinoDatasource) SetQueryArgs(ctx context.Context, headers http.Header) []interface{} {
 	var args []interface{}
 
 	user := ctx.Value(trinoUserHeader)
 	accessToken := ctx.Value(accessTokenKey)
 	clientTags := ctx.Value(trinoClientTagsKey)
+	clientInfo := ctx.Value(trinoClientInfoKey)
+	sessionProperties := ctx.Value(trinoSessionKey)
+	catalog := ctx.Value(trinoCatalogKey)
+	schema := ctx.Value(trinoSchemaKey)
+	roles := ctx.Value(trinoRoleKey)
 
 	if user != nil {
-		args = append(args, sql.Named(trinoUserHeader, string(user.(*backend.User).Login)))
+		args = append(args, sql.Named(trinoUserHeader, user.(string)))
 	}
 
 	if accessToken != nil {
@@ -94,20 +193,206 @@ func (s *TrinoDatasource) SetQueryArgs(ctx context.Context, headers http.Header)
 		args = append(args, sql.Named(trinoClientTagsKey, clientTags.(string)))
 	}
 
+	if clientInfo != nil {
+		args = append(args, sql.Named(trinoClientInfoKey, clientInfo.(string)))
+	}
+
+	if sessionProperties != nil {
+		args = append(args, sql.Named(trinoSessionKey, formatSessionProperties(s.settings.SessionProperties, sessionProperties.(map[string]string))))
+	}
+
+	if catalog != nil {
+		args = append(args, sql.Named(trinoCatalogKey, catalog.(string)))
+	}
+
+	if schema != nil {
+		args = append(args, sql.Named(trinoSchemaKey, schema.(string)))
+	}
+
+	if roles != nil {
+		args = append(args, sql.Named(trinoRoleKey, roles.(map[string]string)))
+	}
+
 	return args
 }
 
+// formatSessionProperties formats the X-Trino-Session header value. As it
+// replaces the header set from the data source settings, the data source
+// properties are included, overridden by the query properties.
+func formatSessionProperties(datasourceProperties, queryProperties map[string]string) string {
+	merged := make(map[string]string, len(datasourceProperties)+len(queryProperties))
+	for name, value := range datasourceProperties {
+		merged[name] = value
+	}
+	for name, value := range queryProperties {
+		merged[name] = value
+	}
+
+	properties := make([]string, 0, len(merged))
+	for name, value := range merged {
+		properties = append(properties, name+"="+url.QueryEscape(value))
+	}
+	sort.Strings(properties)
+	return strings.Join(properties, ",")
+}
+
+// Catalogs lists the catalogs.
+func (s *TrinoDatasource) Catalogs(ctx context.Context) ([]string, error) {
+	return s.queryNames(ctx, "SHOW CATALOGS")
+}
+
+// serveCatalogs serves the catalogs completion endpoint, which lists the
+// catalogs even with a default catalog, like the sqlds endpoints.
+func (s *TrinoDatasource) serveCatalogs(rw http.ResponseWriter, req *http.Request) {
+	catalogs, err := s.Catalogs(req.Context())
+	sendCompletion(rw, catalogs, err)
+}
+
+// serveColumnTypes serves the column types completion endpoint, which lists
+// the columns of the table given in the options of the request body, like
+// the columns endpoint of sqlds, with their types.
+func (s *TrinoDatasource) serveColumnTypes(rw http.ResponseWriter, req *http.Request) {
+	options := sqlds.Options{}
+	if req.Body != nil {
+		if err := json.NewDecoder(req.Body).Decode(&options); err != nil {
+			sendCompletion(rw, nil, err)
+			return
+		}
+	}
+	columns, err := s.TableColumns(req.Context(), options)
+	sendCompletion(rw, columns, err)
+}
+
+// sendCompletion writes the result of a completion endpoint as JSON, or its
+// error, like the sqlds endpoints.
+func sendCompletion(rw http.ResponseWriter, result interface{}, err error) {
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		_, _ = rw.Write([]byte(err.Error()))
+		return
+	}
+	rw.Header().Add("Content-Type", "application/json")
+	_ = json.NewEncoder(rw).Encode(result)
+}
+
+// Schemas lists the schemas of the catalog given in the "catalog" option,
+// defaulting to the data source default catalog. As Trino names are
+// catalog-qualified, the catalogs themselves are listed when there is no
+// catalog, while the catalogs endpoint lists them in any case.
 func (s *TrinoDatasource) Schemas(ctx context.Context, options sqlds.Options) ([]string, error) {
-	// TBD
-	return []string{}, nil
+	catalog, _ := s.scope(options)
+	if catalog == "" {
+		return s.Catalogs(ctx)
+	}
+	return s.queryNames(ctx, "SHOW SCHEMAS FROM "+quoteIdentifier(catalog))
 }
 
+// Tables lists the tables of the schema given in the "catalog" and "schema"
+// options, defaulting to the data source default catalog and schema.
 func (s *TrinoDatasource) Tables(ctx context.Context, options sqlds.Options) ([]string, error) {
-	// TBD
-	return []string{}, nil
+	catalog, schema := s.scope(options)
+	if catalog == "" || schema == "" {
+		return nil, errors.New("catalog and schema are required to list tables")
+	}
+	return s.queryNames(ctx, "SHOW TABLES FROM "+qualifiedName(catalog, schema))
 }
 
+// Columns lists the names of the columns of the table given in the "catalog",
+// "schema" and "table" options, defaulting to the data source default catalog
+// and schema.
 func (s *TrinoDatasource) Columns(ctx context.Context, options sqlds.Options) ([]string, error) {
-	// TBD
-	return []string{}, nil
+	columns, err := s.TableColumns(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.Name
+	}
+	return names, nil
+}
+
+// TableColumn is a column of a table, with its Trino type.
+type TableColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// TableColumns lists the columns of the table given in the options, like
+// Columns, with their types.
+func (s *TrinoDatasource) TableColumns(ctx context.Context, options sqlds.Options) ([]TableColumn, error) {
+	catalog, schema := s.scope(options)
+	table := options[tableOption]
+	if catalog == "" || schema == "" || table == "" {
+		return nil, errors.New("catalog, schema and table are required to list columns")
+	}
+	rows, err := s.query(ctx, "SHOW COLUMNS FROM "+qualifiedName(catalog, schema, table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := []TableColumn{}
+	for rows.Next() {
+		var name, columnType, extra, comment sql.NullString
+		if err := rows.Scan(&name, &columnType, &extra, &comment); err != nil {
+			return nil, err
+		}
+		columns = append(columns, TableColumn{Name: name.String, Type: columnType.String})
+	}
+	return columns, rows.Err()
+}
+
+// scope returns the catalog and schema of the completion options, falling
+// back to the data source default catalog and schema.
+func (s *TrinoDatasource) scope(options sqlds.Options) (string, string) {
+	catalog, schema := options[catalogOption], options[schemaOption]
+	if catalog == "" {
+		catalog = s.settings.DefaultCatalog
+	}
+	if schema == "" && catalog == s.settings.DefaultCatalog {
+		schema = s.settings.DefaultSchema
+	}
+	return catalog, schema
+}
+
+// queryNames runs a SHOW statement and returns the values of its first column.
+func (s *TrinoDatasource) queryNames(ctx context.Context, query string) ([]string, error) {
+	rows, err := s.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// query runs a metadata query with the same query arguments as the panel
+// queries, so that it is executed as the impersonated user with the forwarded
+// access token.
+func (s *TrinoDatasource) query(ctx context.Context, query string) (*sql.Rows, error) {
+	if s.db == nil {
+		return nil, errors.New("data source is not connected")
+	}
+	return s.db.QueryContext(ctx, query, s.SetQueryArgs(ctx, nil)...)
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func qualifiedName(parts ...string) string {
+	quoted := make([]string, len(parts))
+	for i, part := range parts {
+		quoted[i] = quoteIdentifier(part)
+	}
+	return strings.Join(quoted, ".")
 }
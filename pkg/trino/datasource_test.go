@@ -0,0 +1,361 @@
+package trino
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/sqlds/v4"
+)
+
+// fakeTrino is a minimal Trino coordinator serving canned results over the
+// client protocol: the statement POST returns a nextUri, which returns the
+// columns and rows in one page.
+type fakeTrino struct {
+	*httptest.Server
+
+	lock    sync.Mutex
+	queries []string
+	headers []http.Header
+	results map[string]fakeResult
+	// deleted are the URIs deleted to cancel queries.
+	deleted []string
+}
+
+type fakeResult struct {
+	columns []string
+	types   []string
+	rows    [][]interface{}
+	// stats are the statistics of the finished query.
+	stats map[string]interface{}
+	// running queries return their rows and never finish.
+	running bool
+	// pageSize splits the rows into pages, served by the nextUri of the
+	// previous page.
+	pageSize int
+}
+
+func newFakeTrino(t *testing.T) *fakeTrino {
+	f := &fakeTrino{results: map[string]fakeResult{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeTrino) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/statement":
+		body, _ := io.ReadAll(r.Body)
+		query := string(body)
+		f.lock.Lock()
+		f.queries = append(f.queries, query)
+		f.headers = append(f.headers, r.Header.Clone())
+		id := len(f.queries) - 1
+		f.lock.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":      "query",
+			"nextUri": f.URL + "/v1/statement/executing/" + strconv.Itoa(id),
+			"stats":   map[string]interface{}{"state": "QUEUED"},
+		})
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/statement/executing/"):
+		id, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/v1/statement/executing/"))
+		f.lock.Lock()
+		query := f.queries[id]
+		result := f.results[query]
+		f.lock.Unlock()
+		columns := make([]map[string]interface{}, len(result.columns))
+		for i, name := range result.columns {
+			signature := typeSignature(parseTrinoType(result.types[i]))
+			if !strings.Contains(result.types[i], "(") {
+				// Keep the case of raw types like Geometry.
+				signature["rawType"] = result.types[i]
+			}
+			columns[i] = map[string]interface{}{
+				"name":          name,
+				"type":          result.types[i],
+				"typeSignature": signature,
+			}
+		}
+		if result.running {
+			response := map[string]interface{}{
+				"id":      "query",
+				"nextUri": f.URL + r.URL.Path + "?page=1",
+				"stats":   map[string]interface{}{"state": "RUNNING"},
+			}
+			if r.URL.Query().Get("page") == "" && len(columns) > 0 {
+				response["columns"] = columns
+				response["data"] = result.rows
+			} else {
+				time.Sleep(10 * time.Millisecond)
+			}
+			_ = json.NewEncoder(w).Encode(response)
+			return
+		}
+		stats := map[string]interface{}{"state": "FINISHED"}
+		for name, value := range result.stats {
+			stats[name] = value
+		}
+		response := map[string]interface{}{
+			"id":      "query",
+			"infoUri": f.URL + "/ui/query.html?query",
+			"columns": columns,
+			"data":    result.rows,
+			"stats":   stats,
+		}
+		if result.pageSize > 0 {
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			start, end := page*result.pageSize, (page+1)*result.pageSize
+			if end < len(result.rows) {
+				response["nextUri"] = f.URL + r.URL.Path + "?page=" + strconv.Itoa(page+1)
+				response["stats"] = map[string]interface{}{"state": "RUNNING"}
+			} else {
+				end = len(result.rows)
+			}
+			response["data"] = result.rows[start:end]
+		}
+		_ = json.NewEncoder(w).Encode(response)
+	case r.Method == http.MethodDelete:
+		f.lock.Lock()
+		f.deleted = append(f.deleted, f.URL+r.URL.RequestURI())
+		f.lock.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// waitForDelete waits for a URI to be deleted, as queries are canceled
+// asynchronously.
+func (f *fakeTrino) waitForDelete(t *testing.T, uri string) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		f.lock.Lock()
+		deleted := append([]string(nil), f.deleted...)
+		f.lock.Unlock()
+		for _, d := range deleted {
+			if d == uri {
+				return
+			}
+		}
+	}
+	t.Errorf("%s wasn't deleted", uri)
+}
+
+// typeSignature returns the client protocol type signature of a type.
+func typeSignature(t trinoType) map[string]interface{} {
+	arguments := []interface{}{}
+	for _, param := range t.params {
+		switch {
+		case param.typ == nil:
+			value, _ := strconv.ParseInt(param.literal, 10, 64)
+			arguments = append(arguments, map[string]interface{}{"kind": "LONG", "value": value})
+		case t.name == "row":
+			arguments = append(arguments, map[string]interface{}{"kind": "NAMED_TYPE", "value": map[string]interface{}{
+				"fieldName":     map[string]interface{}{"name": param.field},
+				"typeSignature": typeSignature(*param.typ),
+			}})
+		default:
+			arguments = append(arguments, map[string]interface{}{"kind": "TYPE", "value": typeSignature(*param.typ)})
+		}
+	}
+	return map[string]interface{}{"rawType": t.name, "arguments": arguments}
+}
+
+func (f *fakeTrino) lastHeader() http.Header {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.headers[len(f.headers)-1]
+}
+
+func (f *fakeTrino) settings(jsonData string) backend.DataSourceInstanceSettings {
+	return backend.DataSourceInstanceSettings{
+		UID:      "trino",
+		URL:      f.URL,
+		JSONData: []byte(jsonData),
+	}
+}
+
+func connectFake(t *testing.T, f *fakeTrino, jsonData string) *TrinoDatasource {
+	s := New()
+	if _, err := s.Connect(context.Background(), f.settings(jsonData), nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return s
+}
+
+func TestCompletion(t *testing.T) {
+	f := newFakeTrino(t)
+	f.results["SHOW CATALOGS"] = fakeResult{
+		columns: []string{"Catalog"},
+		types:   []string{"varchar"},
+		rows:    [][]interface{}{{"hive"}, {"tpch"}},
+	}
+	f.results[`SHOW SCHEMAS FROM "tpch"`] = fakeResult{
+		columns: []string{"Schema"},
+		types:   []string{"varchar"},
+		rows:    [][]interface{}{{"information_schema"}, {"tiny"}},
+	}
+	f.results[`SHOW TABLES FROM "tpch"."tiny"`] = fakeResult{
+		columns: []string{"Table"},
+		types:   []string{"varchar"},
+		rows:    [][]interface{}{{"customer"}, {"orders"}},
+	}
+	f.results[`SHOW COLUMNS FROM "tpch"."tiny"."orders"`] = fakeResult{
+		columns: []string{"Column", "Type", "Extra", "Comment"},
+		types:   []string{"varchar", "varchar", "varchar", "varchar"},
+		rows:    [][]interface{}{{"orderkey", "bigint", "", ""}, {"orderdate", "date", "", nil}},
+	}
+	s := connectFake(t, f, `{}`)
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		list    func(context.Context, sqlds.Options) ([]string, error)
+		options sqlds.Options
+		want    []string
+	}{
+		{name: "catalogs", list: s.Schemas, options: sqlds.Options{}, want: []string{"hive", "tpch"}},
+		{name: "schemas", list: s.Schemas, options: sqlds.Options{"catalog": "tpch"}, want: []string{"information_schema", "tiny"}},
+		{name: "tables", list: s.Tables, options: sqlds.Options{"catalog": "tpch", "schema": "tiny"}, want: []string{"customer", "orders"}},
+		{
+			name:    "columns",
+			list:    s.Columns,
+			options: sqlds.Options{"catalog": "tpch", "schema": "tiny", "table": "orders"},
+			want:    []string{"orderkey", "orderdate"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.list(ctx, tt.options)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("column types", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, columnTypesRoute, strings.NewReader(`{"catalog": "tpch", "schema": "tiny", "table": "orders"}`))
+		rec := httptest.NewRecorder()
+		s.serveColumnTypes(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+		}
+		var got []TableColumn
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := []TableColumn{{Name: "orderkey", Type: "bigint"}, {Name: "orderdate", Type: "date"}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+}
+
+func TestCompletion_MissingOptions(t *testing.T) {
+	s := connectFake(t, newFakeTrino(t), `{}`)
+
+	if _, err := s.Tables(context.Background(), sqlds.Options{"catalog": "tpch"}); err == nil {
+		t.Error("expected an error when listing tables without a schema")
+	}
+	if _, err := s.Columns(context.Background(), sqlds.Options{"catalog": "tpch", "schema": "tiny"}); err == nil {
+		t.Error("expected an error when listing columns without a table")
+	}
+}
+
+func TestCompletion_QuotesIdentifiers(t *testing.T) {
+	f := newFakeTrino(t)
+	s := connectFake(t, f, `{}`)
+
+	if _, err := s.Schemas(context.Background(), sqlds.Options{"catalog": `my"catalog`}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := `SHOW SCHEMAS FROM "my""catalog"`; f.queries[0] != want {
+		t.Errorf("got query %q, want %q", f.queries[0], want)
+	}
+}
+
+func TestCompletion_UsesQueryArgs(t *testing.T) {
+	f := newFakeTrino(t)
+	s := connectFake(t, f, `{}`)
+
+	ctx := context.WithValue(context.Background(), trinoUserHeader, "alice")
+	ctx = context.WithValue(ctx, accessTokenKey, "user-token")
+	if _, err := s.Schemas(ctx, sqlds.Options{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	header := f.lastHeader()
+	if got := header.Get(trinoUserHeader); got != "alice" {
+		t.Errorf("got Trino user %q, want %q", got, "alice")
+	}
+	if got := header.Get("Authorization"); got != "Bearer user-token" {
+		t.Errorf("got Authorization header %q, want %q", got, "Bearer user-token")
+	}
+}
+
+func TestCompletion_DefaultScope(t *testing.T) {
+	f := newFakeTrino(t)
+	s := connectFake(t, f, `{"defaultCatalog": "tpch", "defaultSchema": "tiny"}`)
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		list      func(context.Context, sqlds.Options) ([]string, error)
+		options   sqlds.Options
+		wantQuery string
+	}{
+		{name: "schemas of the default catalog", list: s.Schemas, options: sqlds.Options{}, wantQuery: `SHOW SCHEMAS FROM "tpch"`},
+		{name: "tables of the default schema", list: s.Tables, options: sqlds.Options{}, wantQuery: `SHOW TABLES FROM "tpch"."tiny"`},
+		{name: "tables of another schema", list: s.Tables, options: sqlds.Options{"schema": "sf1"}, wantQuery: `SHOW TABLES FROM "tpch"."sf1"`},
+		{name: "tables of another catalog", list: s.Tables, options: sqlds.Options{"catalog": "hive", "schema": "web"}, wantQuery: `SHOW TABLES FROM "hive"."web"`},
+		{name: "columns in the default schema", list: s.Columns, options: sqlds.Options{"table": "orders"}, wantQuery: `SHOW COLUMNS FROM "tpch"."tiny"."orders"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.list(ctx, tt.options); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := f.queries[len(f.queries)-1]; got != tt.wantQuery {
+				t.Errorf("got query %q, want %q", got, tt.wantQuery)
+			}
+		})
+	}
+
+	if _, err := s.Tables(ctx, sqlds.Options{"catalog": "hive"}); err == nil {
+		t.Error("expected an error listing tables of a catalog without a schema")
+	}
+}
+
+func TestResultLimit(t *testing.T) {
+	for _, tt := range []struct {
+		query, datasource, ceiling int64
+		want                       int64
+	}{
+		{want: 0},
+		{datasource: 100, want: 100},
+		{query: 10, datasource: 100, want: 10},
+		{query: 1000, datasource: 100, want: 1000},
+		{query: 1000, datasource: 100, ceiling: 500, want: 500},
+		{datasource: 1000, ceiling: 500, want: 500},
+		{ceiling: 500, want: 500},
+	} {
+		if got := resultLimit(tt.query, tt.datasource, tt.ceiling); got != tt.want {
+			t.Errorf("resultLimit(%d, %d, %d) = %d, want %d", tt.query, tt.datasource, tt.ceiling, got, tt.want)
+		}
+	}
+}
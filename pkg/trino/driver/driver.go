@@ -1,12 +1,17 @@
 package driver
 
 import (
+	"context"
+	"crypto"
 	"crypto/tls"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
+	"sync/atomic"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend/httpclient"
 	trinoClient "github.com/trinodb/grafana-trino/pkg/trino/client"
@@ -19,7 +24,15 @@ import (
 const DriverName string = "trino"
 
 // just compile time assertion
-var _ http.RoundTripper = &customTransport{}
+var (
+	_ http.RoundTripper = &customTransport{}
+	_ driver.Connector  = &connector{}
+	_ io.Closer         = &connector{}
+)
+
+// clientCounter makes custom client names unique even when the same settings
+// revision is opened more than once, e.g. on reconnect.
+var clientCounter atomic.Uint64
 
 type customTransport struct {
 	client *trinoClient.Client
@@ -29,8 +42,42 @@ func (t *customTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	return t.client.Do(req)
 }
 
-// Open registers a new driver with a unique name
+// connector opens Trino connections using the custom HTTP client registered
+// for a single datasource instance. The client is deregistered when the
+// sql.DB is closed, which happens when the instance is disposed.
+type connector struct {
+	dsn        string
+	clientName string
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	trinoConn, err := c.Driver().Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: trinoConn}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return &trino.Driver{}
+}
+
+func (c *connector) Close() error {
+	trino.DeregisterCustomClient(c.clientName)
+	return nil
+}
+
+// Open registers a new custom HTTP client with a unique name and opens a
+// sql.DB using it
 func Open(settings models.TrinoDatasourceSettings) (*sql.DB, error) {
+	c, err := newConnector(settings)
+	if err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(c), nil
+}
+
+func newConnector(settings models.TrinoDatasourceSettings) (*connector, error) {
 	tlsConfig, err := buildTLSConfig(settings.Opts.TLS)
 	if err != nil {
 		return nil, err
@@ -40,18 +87,25 @@ func Open(settings models.TrinoDatasourceSettings) (*sql.DB, error) {
 			TLSClientConfig: tlsConfig,
 		},
 	}
-	if settings.TokenUrl != "" || settings.ClientId != "" || settings.ClientSecret != "" {
+	if settings.TokenUrl != "" || settings.IssuerUrl != "" || settings.ClientId != "" || settings.ClientSecret != "" || settings.ClientPrivateKey != "" {
 		if settings.AccessToken != "" {
 			return nil, errors.New("access token must not be set within 'OAuth Trino Authentication' settings")
 		}
 		var missingParams []string
-		if settings.TokenUrl == "" {
-			missingParams = append(missingParams, "Token URL")
+		if settings.TokenUrl == "" && settings.IssuerUrl == "" {
+			missingParams = append(missingParams, "Token URL or Issuer URL")
 		}
 		if settings.ClientId == "" {
 			missingParams = append(missingParams, "Client id")
 		}
-		if settings.ClientSecret == "" {
+		var privateKey crypto.Signer
+		if settings.TokenAuthMethod == models.TokenAuthPrivateKeyJWT {
+			if settings.ClientPrivateKey == "" {
+				missingParams = append(missingParams, "Client private key")
+			} else if privateKey, err = trinoClient.ParsePrivateKey(settings.ClientPrivateKey); err != nil {
+				return nil, err
+			}
+		} else if settings.ClientSecret == "" {
 			missingParams = append(missingParams, "Client secret")
 		}
 		if len(missingParams) > 0 {
@@ -64,17 +118,32 @@ func Open(settings models.TrinoDatasourceSettings) (*sql.DB, error) {
 					ClientId:          settings.ClientId,
 					ClientSecret:      settings.ClientSecret,
 					Url:               settings.TokenUrl,
+					IssuerUrl:         settings.IssuerUrl,
 					ImpersonationUser: settings.ImpersonationUser,
+					Scopes:            strings.Fields(settings.Scopes),
+					Audience:          settings.Audience,
+					Resource:          settings.Resource,
+					Params:            settings.TokenParams,
+					AuthMethod:        settings.TokenAuthMethod,
+					PrivateKey:        privateKey,
+					KeyId:             settings.ClientKeyId,
+					TokenExchange:     settings.TokenExchange != "",
+					UserParam:         settings.TokenExchangeUserParam,
 				},
 			},
 		}
 	}
-	err = trino.RegisterCustomClient("grafana", client)
+	// Columns of unsupported types, like sketches, are read as supported
+	// types, and queries are canceled when their context is done.
+	client = &http.Client{Transport: newStatementTransport(client.Transport)}
+
+	roles, err := models.ParseRoles(settings.Roles)
 	if err != nil {
 		return nil, err
 	}
 
-	roles, err := parseRoles(settings.Roles)
+	clientName := customClientName(settings)
+	err = trino.RegisterCustomClient(clientName, client)
 	if err != nil {
 		return nil, err
 	}
@@ -82,17 +151,27 @@ func Open(settings models.TrinoDatasourceSettings) (*sql.DB, error) {
 	config := trino.Config{
 		ServerURI:                  settings.URL.String(),
 		Source:                     "grafana",
-		CustomClientName:           "grafana",
+		Catalog:                    settings.DefaultCatalog,
+		Schema:                     settings.DefaultSchema,
+		CustomClientName:           clientName,
 		ForwardAuthorizationHeader: true,
 		AccessToken:                settings.AccessToken,
 		Roles:                      roles,
+		SessionProperties:          settings.SessionProperties,
 	}
 
 	dsn, err := config.FormatDSN()
 	if err != nil {
+		trino.DeregisterCustomClient(clientName)
 		return nil, err
 	}
-	return sql.Open(DriverName, dsn)
+	return &connector{dsn: dsn, clientName: clientName}, nil
+}
+
+// customClientName returns a name identifying the datasource instance and the
+// revision of its settings.
+func customClientName(settings models.TrinoDatasourceSettings) string {
+	return fmt.Sprintf("grafana-%s-%d-%d", settings.UID, settings.Updated.UnixNano(), clientCounter.Add(1))
 }
 
 // buildTLSConfig builds the tls.Config used for connections to Trino from
@@ -105,23 +184,3 @@ func buildTLSConfig(opts *httpclient.TLSOptions) (*tls.Config, error) {
 
 	return httpclient.GetTLSConfig(httpclient.Options{TLS: opts})
 }
-
-func parseRoles(roleStr string) (map[string]string, error) {
-	roles := make(map[string]string)
-	if strings.TrimSpace(roleStr) == "" {
-		return roles, nil
-	}
-	pairs := strings.Split(roleStr, ";")
-	for _, pair := range pairs {
-		parts := strings.SplitN(pair, ":", 2)
-		if len(parts) != 2 {
-			return nil, fmt.Errorf("Invalid role format. expected catalog:role, got '%s'", pair)
-		}
-		catalog := strings.TrimSpace(parts[0])
-		role := strings.TrimSpace(parts[1])
-		if catalog != "" && role != "" {
-			roles[catalog] = role
-		}
-	}
-	return roles, nil
-}
@@ -2,18 +2,25 @@ package driver
 
 import (
 	"bytes"
+	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"database/sql"
+	"encoding/json"
 	"encoding/pem"
 	"math/big"
-	"reflect"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend/httpclient"
+	"github.com/trinodb/grafana-trino/pkg/trino/models"
 )
 
 func TestBuildTLSConfig(t *testing.T) {
@@ -120,52 +127,136 @@ func selfSignedCert(t *testing.T) (certPEM, keyPEM string) {
 	return certBuf.String(), keyBuf.String()
 }
 
-func TestParseRoles(t *testing.T) {
-	tests := []struct {
-		name    string
-		input   string
-		want    map[string]string
-		wantErr bool
-	}{
-		{name: "empty", input: "", want: map[string]string{}},
-		{name: "blank", input: "   ", want: map[string]string{}},
-		{
-			name:  "single",
-			input: "system:admin",
-			want:  map[string]string{"system": "admin"},
-		},
-		{
-			name:  "multiple",
-			input: "system:admin;catalog1:roleA;catalog2:roleB",
-			want:  map[string]string{"system": "admin", "catalog1": "roleA", "catalog2": "roleB"},
-		},
-		{
-			name:  "trims whitespace",
-			input: " system : admin ; catalog1 : roleA ",
-			want:  map[string]string{"system": "admin", "catalog1": "roleA"},
-		},
-		{
-			name:    "missing colon",
-			input:   "system-admin",
-			wantErr: true,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got, err := parseRoles(tt.input)
-			if tt.wantErr {
-				if err == nil {
-					t.Fatalf("expected error, got nil")
-				}
-				return
-			}
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("got %v, want %v", got, tt.want)
-			}
+// newFakeTrino starts a Trino coordinator stub answering every statement with
+// an empty result and recording the Authorization header it received.
+func newFakeTrino(t *testing.T, tlsServer bool) (*httptest.Server, *atomic.Value) {
+	var authorization atomic.Value
+	authorization.Store("")
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization.Store(r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":    "query",
+			"stats": map[string]interface{}{"state": "FINISHED"},
 		})
+	})
+	var server *httptest.Server
+	if tlsServer {
+		server = httptest.NewTLSServer(handler)
+	} else {
+		server = httptest.NewServer(handler)
+	}
+	t.Cleanup(server.Close)
+	return server, &authorization
+}
+
+func newTokenServer(t *testing.T, accessToken string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": accessToken,
+			"expires_in":   3600,
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func testSettings(t *testing.T, uid string, serverURL string) models.TrinoDatasourceSettings {
+	t.Helper()
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	u.User = url.User("grafana")
+	return models.TrinoDatasourceSettings{UID: uid, URL: u}
+}
+
+func runQuery(t *testing.T, db *sql.DB) error {
+	t.Helper()
+	rows, err := db.QueryContext(context.Background(), "SELECT 1")
+	if err != nil {
+		return err
+	}
+	return rows.Close()
+}
+
+func TestOpen_InstancesDoNotShareClients(t *testing.T) {
+	tlsTrino, tlsAuthorization := newFakeTrino(t, true)
+	oauthTrino, oauthAuthorization := newFakeTrino(t, false)
+	tokenServer := newTokenServer(t, "token-b")
+
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsTrino.Certificate().Raw})
+	tlsSettings := testSettings(t, "tls", tlsTrino.URL)
+	tlsSettings.Opts = httpclient.Options{TLS: &httpclient.TLSOptions{CACertificate: string(caPEM)}}
+
+	oauthSettings := testSettings(t, "oauth", oauthTrino.URL)
+	oauthSettings.TokenUrl = tokenServer.URL
+	oauthSettings.ClientId = "id-b"
+	oauthSettings.ClientSecret = "secret-b"
+
+	// Open both before querying, so that a shared registration would have
+	// been overwritten by the second one.
+	tlsDB, err := Open(tlsSettings)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = tlsDB.Close() })
+	oauthDB, err := Open(oauthSettings)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = oauthDB.Close() })
+
+	if err := runQuery(t, tlsDB); err != nil {
+		t.Fatalf("query through the TLS instance failed: %v", err)
+	}
+	if got := tlsAuthorization.Load(); got != "" {
+		t.Errorf("TLS instance sent the OAuth instance's Authorization header %q", got)
+	}
+
+	if err := runQuery(t, oauthDB); err != nil {
+		t.Fatalf("query through the OAuth instance failed: %v", err)
+	}
+	if got := oauthAuthorization.Load(); got != "Bearer token-b" {
+		t.Errorf("got Authorization header %q, want %q", got, "Bearer token-b")
+	}
+}
+
+func TestOpen_ClientNamesAreUnique(t *testing.T) {
+	settings := testSettings(t, "uid", "http://localhost:8080")
+
+	first, err := newConnector(settings)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = first.Close() })
+	settings.Updated = time.Now()
+	second, err := newConnector(settings)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = second.Close() })
+
+	if first.clientName == second.clientName {
+		t.Errorf("expected distinct client names, both are %q", first.clientName)
+	}
+}
+
+func TestOpen_CloseDeregistersClient(t *testing.T) {
+	c, err := newConnector(testSettings(t, "uid", "http://localhost:8080"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := c.Connect(context.Background()); err != nil {
+		t.Fatalf("unexpected error before close: %v", err)
+	}
+
+	if err := sql.OpenDB(c).Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := c.Connect(context.Background()); err == nil {
+		t.Error("expected the custom client to be deregistered after the DB was closed")
 	}
 }
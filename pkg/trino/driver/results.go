@@ -0,0 +1,244 @@
+package driver
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+type resultsKey struct{}
+
+// Column describes a column of a query result.
+type Column struct {
+	Name string
+	// Type is the Trino type name as reported by the client, in upper case,
+	// e.g. BIGINT or ROW(X INTEGER, Y VARCHAR).
+	Type string
+	// TrinoType is the type name sent by Trino, before unsupported types
+	// are rewritten, e.g. varchar(10) or ipprefix.
+	TrinoType string
+	// Precision and Scale are set for the decimal, time and timestamp types.
+	Precision    int64
+	Scale        int64
+	HasPrecision bool
+}
+
+// QueryInfo describes the last state of a query sent by Trino.
+type QueryInfo struct {
+	ID string `json:"id"`
+	// InfoURI links to the query in the web UI of the coordinator.
+	InfoURI string     `json:"infoUri"`
+	Stats   QueryStats `json:"stats"`
+}
+
+// QueryStats are the execution statistics of a query.
+type QueryStats struct {
+	State             string `json:"state"`
+	QueuedTimeMillis  int64  `json:"queuedTimeMillis"`
+	ElapsedTimeMillis int64  `json:"elapsedTimeMillis"`
+	CPUTimeMillis     int64  `json:"cpuTimeMillis"`
+	ProcessedRows     int64  `json:"processedRows"`
+	ProcessedBytes    int64  `json:"processedBytes"`
+	PeakMemoryBytes   int64  `json:"peakMemoryBytes"`
+}
+
+// Results records the result columns, the last state and the truncation of
+// the results of a query run with a context returned by WithResults. They
+// are replaced when the query is retried.
+type Results struct {
+	lock       sync.Mutex
+	columns    []Column
+	trinoTypes []string
+	query      QueryInfo
+	truncation string
+}
+
+// WithResults returns a context recording the result columns, the state and
+// the truncation of the results of the query run with it in results.
+func WithResults(ctx context.Context, results *Results) context.Context {
+	return context.WithValue(ctx, resultsKey{}, results)
+}
+
+// Columns returns the recorded columns.
+func (r *Results) Columns() []Column {
+	if r == nil {
+		return nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.columns
+}
+
+// Query returns the last recorded state of the query.
+func (r *Results) Query() QueryInfo {
+	if r == nil {
+		return QueryInfo{}
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.query
+}
+
+func (r *Results) recordColumns(rows driver.Rows) {
+	if r == nil {
+		return
+	}
+	names := rows.Columns()
+	columns := make([]Column, len(names))
+	for i, name := range names {
+		columns[i].Name = name
+		if typed, ok := rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+			columns[i].Type = typed.ColumnTypeDatabaseTypeName(i)
+		}
+		if typed, ok := rows.(driver.RowsColumnTypePrecisionScale); ok {
+			columns[i].Precision, columns[i].Scale, columns[i].HasPrecision = typed.ColumnTypePrecisionScale(i)
+		}
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if len(r.trinoTypes) == len(columns) {
+		for i := range columns {
+			columns[i].TrinoType = r.trinoTypes[i]
+		}
+	}
+	r.columns = columns
+	r.truncation = ""
+}
+
+// recordedTrinoTypes returns the type names sent by Trino.
+func (r *Results) recordedTrinoTypes() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.trinoTypes
+}
+
+// Truncation returns the notice of the truncation of the results, if they
+// reached a limit.
+func (r *Results) Truncation() string {
+	if r == nil {
+		return ""
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.truncation
+}
+
+func (r *Results) recordTruncation(notice string) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.truncation = notice
+}
+
+// recordResponse records the column types and the state of the query in a
+// response of the client protocol. They are reset when a query is started,
+// so that those of retried queries are recorded again.
+func (r *Results) recordResponse(started bool, response statementResponse) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if started {
+		r.trinoTypes = nil
+	}
+	if r.trinoTypes == nil && len(response.Columns) > 0 {
+		var columns []struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(response.Columns, &columns); err == nil {
+			r.trinoTypes = make([]string, len(columns))
+			for i, column := range columns {
+				r.trinoTypes[i] = column.Type
+			}
+		}
+	}
+	if response.ID != "" {
+		r.query = response.QueryInfo
+	}
+}
+
+// conn wraps a Trino connection to record the result columns of queries run
+// with a context returned by WithResults, and to run queries with the
+// timeout and the limits of contexts returned by WithTimeout and WithLimits.
+type conn struct {
+	driver.Conn
+}
+
+var (
+	_ driver.ConnPrepareContext = &conn{}
+	_ driver.StmtQueryContext   = &stmt{}
+	_ driver.StmtExecContext    = &stmt{}
+	_ driver.NamedValueChecker  = &stmt{}
+)
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var (
+		st  driver.Stmt
+		err error
+	)
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		st, err = preparer.PrepareContext(ctx, query)
+	} else {
+		st, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{Stmt: st}, nil
+}
+
+type stmt struct {
+	driver.Stmt
+}
+
+// CheckNamedValue lets the Trino statement accept its header query arguments.
+func (s *stmt) CheckNamedValue(arg *driver.NamedValue) error {
+	if checker, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(arg)
+	}
+	return driver.ErrSkip
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.Stmt.(driver.StmtExecContext).ExecContext(ctx, args)
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	results, ok := ctx.Value(resultsKey{}).(*Results)
+	if !ok {
+		// The types sent by Trino are needed to read the text types.
+		results = &Results{}
+		ctx = WithResults(ctx, results)
+	}
+	var cancel context.CancelFunc
+	limits, _ := ctx.Value(limitsKey{}).(Limits)
+	if timeout, ok := ctx.Value(timeoutKey{}).(time.Duration); ok && timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else if limits != (Limits{}) {
+		// Queries are stopped by canceling them when their results are
+		// truncated.
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	queryRows, err := s.Stmt.(driver.StmtQueryContext).QueryContext(ctx, args)
+	if err != nil {
+		if cancel != nil {
+			cancel()
+		}
+		return nil, err
+	}
+	typed, ok := queryRows.(trinoRows)
+	if ok {
+		// The column types are sent with the first results.
+		typed.Columns()
+		typed = withTextTypes(typed, results.recordedTrinoTypes())
+		queryRows = typed
+	}
+	results.recordColumns(queryRows)
+	if ok && cancel != nil {
+		return &rows{trinoRows: typed, cancel: cancel, limits: limits, results: results}, nil
+	}
+	return queryRows, nil
+}
@@ -0,0 +1,137 @@
+package driver
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"time"
+)
+
+type (
+	timeoutKey struct{}
+	limitsKey  struct{}
+)
+
+// WithTimeout returns a context running queries with a timeout. Unlike a
+// context with a deadline, the timeout starts when the query is run and is
+// released when its rows are closed.
+func WithTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, timeoutKey{}, timeout)
+}
+
+// Limits limit the results of a query. Zero means no limit.
+type Limits struct {
+	Rows int64
+	// Bytes limits the estimated size of the values of the rows.
+	Bytes int64
+}
+
+// WithLimits returns a context running queries with result limits. The
+// results of queries reaching a limit are truncated, the query is stopped,
+// and the truncation is recorded in the Results of the context.
+func WithLimits(ctx context.Context, limits Limits) context.Context {
+	return context.WithValue(ctx, limitsKey{}, limits)
+}
+
+// trinoRows are the rows of the Trino client, with their column types.
+type trinoRows interface {
+	driver.Rows
+	driver.RowsColumnTypeScanType
+	driver.RowsColumnTypeDatabaseTypeName
+	driver.RowsColumnTypeLength
+	driver.RowsColumnTypePrecisionScale
+}
+
+// rows are the rows of a query run with a timeout or with limits. The context
+// of the query is canceled when they are closed, releasing the timeout, or
+// when they are truncated, stopping the query.
+type rows struct {
+	trinoRows
+	cancel  context.CancelFunc
+	limits  Limits
+	results *Results
+
+	count     int64
+	bytes     int64
+	truncated bool
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.truncated {
+		return io.EOF
+	}
+	if err := r.trinoRows.Next(dest); err != nil {
+		return err
+	}
+	// The row after the limit is read only to know whether the results are
+	// truncated.
+	if r.limits.Rows > 0 && r.count == r.limits.Rows {
+		return r.truncate(fmt.Sprintf("Results were limited to the first %d rows.", r.limits.Rows))
+	}
+	if r.limits.Bytes > 0 {
+		size := rowSize(dest)
+		if r.bytes+size > r.limits.Bytes {
+			if r.count == 0 {
+				return r.truncate(fmt.Sprintf("Results were truncated to no rows, as the first row has an estimated size of %d bytes, more than the limit of %d bytes.", size, r.limits.Bytes))
+			}
+			return r.truncate(fmt.Sprintf("Results were truncated to the first %d rows, within the limit of %d bytes.", r.count, r.limits.Bytes))
+		}
+		r.bytes += size
+	}
+	r.count++
+	return nil
+}
+
+// truncate ends the rows and stops the query.
+func (r *rows) truncate(notice string) error {
+	r.truncated = true
+	r.results.recordTruncation(notice)
+	r.cancel()
+	return io.EOF
+}
+
+func (r *rows) Close() error {
+	defer r.cancel()
+	err := r.trinoRows.Close()
+	if r.truncated {
+		// The query was canceled.
+		return nil
+	}
+	return err
+}
+
+// rowSize estimates the size of the values of a row.
+func rowSize(values []driver.Value) int64 {
+	var size int64
+	for _, value := range values {
+		size += valueSize(value)
+	}
+	return size
+}
+
+func valueSize(value interface{}) int64 {
+	switch v := value.(type) {
+	case nil:
+		return 0
+	case string:
+		return int64(len(v))
+	case []byte:
+		return int64(len(v))
+	case []interface{}:
+		var size int64
+		for _, element := range v {
+			size += valueSize(element)
+		}
+		return size
+	case map[string]interface{}:
+		var size int64
+		for key, element := range v {
+			size += int64(len(key)) + valueSize(element)
+		}
+		return size
+	default:
+		// Numbers, booleans and times.
+		return 8
+	}
+}
@@ -0,0 +1,117 @@
+package driver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/trinodb/trino-go-client/trino"
+)
+
+// statementResponse holds the fields read from the responses of the client
+// protocol for statements.
+type statementResponse struct {
+	QueryInfo
+	NextURI string `json:"nextUri"`
+	// Columns are decoded only when needed, as they are sent with every page
+	// of the results.
+	Columns json.RawMessage `json:"columns"`
+}
+
+// statementTransport reads the responses of the client protocol for
+// statements: it rewrites the columns of unsupported types, records the
+// results of queries run with a context returned by WithResults, and cancels
+// the queries whose context is done, e.g. on timeouts or when Grafana cancels
+// the request, by deleting their next URI.
+type statementTransport struct {
+	next http.RoundTripper
+
+	lock sync.Mutex
+	// cancels stops the cancellation registered for a next URI, once its
+	// response is read.
+	cancels map[string]func() bool
+}
+
+var _ http.RoundTripper = &statementTransport{}
+
+func newStatementTransport(next http.RoundTripper) *statementTransport {
+	return &statementTransport{next: next, cancels: map[string]func() bool{}}
+}
+
+func (t *statementTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if !strings.HasPrefix(req.URL.Path, "/v1/statement") {
+		return resp, err
+	}
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.cancelOnDone(req, "")
+		return resp, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		t.cancelOnDone(req, "")
+		return nil, err
+	}
+	var response statementResponse
+	err = json.Unmarshal(body, &response)
+	t.cancelOnDone(req, response.NextURI)
+	if err == nil {
+		if results, ok := req.Context().Value(resultsKey{}).(*Results); ok {
+			results.recordResponse(req.Method == http.MethodPost, response)
+		}
+		body = rewriteUnsupportedColumns(body, response.Columns)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Del("Content-Length")
+	return resp, nil
+}
+
+// cancelOnDone replaces the cancellation of the query registered for the
+// request, which got its response, by a cancellation deleting the next URI
+// of the query when the request context is done. Without a next URI, e.g.
+// on the last page or when the request failed, the cancellation is removed.
+func (t *statementTransport) cancelOnDone(req *http.Request, nextURI string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if stop, ok := t.cancels[req.URL.String()]; ok {
+		stop()
+		delete(t.cancels, req.URL.String())
+	}
+	ctx := req.Context()
+	if nextURI == "" || ctx.Done() == nil {
+		return
+	}
+
+	header := req.Header.Clone()
+	t.cancels[nextURI] = context.AfterFunc(ctx, func() {
+		t.lock.Lock()
+		delete(t.cancels, nextURI)
+		t.lock.Unlock()
+		t.cancel(ctx, nextURI, header)
+	})
+}
+
+// cancel deletes the next URI of a query, with the headers of the request
+// that returned it, for the authentication. The request keeps the values of
+// the done context of the query, like the subject of the token exchange.
+func (t *statementTransport) cancel(ctx context.Context, nextURI string, header http.Header) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), trino.DefaultCancelQueryTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, nextURI, nil)
+	if err != nil {
+		return
+	}
+	req.Header = header
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return
+	}
+	_ = resp.Body.Close()
+}
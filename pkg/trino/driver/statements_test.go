@@ -0,0 +1,120 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+type userKey struct{}
+
+func TestStatementTransport_CancelKeepsContextValues(t *testing.T) {
+	const nextURI = "http://trino/v1/statement/executing/0"
+	type deletion struct {
+		req *http.Request
+		err error
+	}
+	deleted := make(chan deletion, 1)
+	transport := newStatementTransport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body := `{"id":"query","nextUri":"` + nextURI + `"}`
+		if req.Method == http.MethodDelete {
+			deleted <- deletion{req: req, err: req.Context().Err()}
+			body = ""
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body)), Header: http.Header{}}, nil
+	}))
+
+	// The context values, like the subject of the token exchange, are read
+	// by the client authenticating the requests.
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), userKey{}, "alice"))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://trino/v1/statement", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer alice-token")
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = resp.Body.Close()
+	cancel()
+
+	select {
+	case deletion := <-deleted:
+		req := deletion.req
+		if req.URL.String() != nextURI {
+			t.Errorf("got DELETE %s, want %s", req.URL, nextURI)
+		}
+		if got := req.Context().Value(userKey{}); got != "alice" {
+			t.Errorf("got context value %v, want the one of the query", got)
+		}
+		if err := deletion.err; err != nil {
+			t.Errorf("got a done context: %v", err)
+		}
+		if _, ok := req.Context().Deadline(); !ok {
+			t.Error("got a context without a timeout")
+		}
+		if got := req.Header.Get("Authorization"); got != "Bearer alice-token" {
+			t.Errorf("got Authorization header %q, want the one of the query", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the query was not canceled")
+	}
+}
+
+func TestStatementTransport_RemovesCancellationsOfFailedPages(t *testing.T) {
+	const nextURI = "http://trino/v1/statement/executing/0"
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		err    error
+	}{
+		{name: "error", err: errors.New("connection reset")},
+		{name: "server error", status: http.StatusInternalServerError, body: "failed"},
+		{name: "last page", status: http.StatusOK, body: `{"id":"query"}`},
+		{name: "invalid page", status: http.StatusOK, body: "{"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := newStatementTransport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				body := `{"id":"query","nextUri":"` + nextURI + `"}`
+				if req.Method == http.MethodGet {
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return &http.Response{StatusCode: tt.status, Body: io.NopCloser(strings.NewReader(tt.body)), Header: http.Header{}}, nil
+				}
+				return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body)), Header: http.Header{}}, nil
+			}))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			for _, page := range []struct{ method, uri string }{{http.MethodPost, "http://trino/v1/statement"}, {http.MethodGet, nextURI}} {
+				req, err := http.NewRequestWithContext(ctx, page.method, page.uri, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if resp, err := transport.RoundTrip(req); err == nil {
+					_ = resp.Body.Close()
+				}
+			}
+
+			transport.lock.Lock()
+			defer transport.lock.Unlock()
+			if len(transport.cancels) != 0 {
+				t.Errorf("got cancellations of %v, want none", transport.cancels)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package driver
+
+import (
+	"strconv"
+	"strings"
+)
+
+// textTypes are the Trino types read as varchar, so that their values are
+// scanned as the text sent by Trino. The client parses timestamps without a
+// time zone in the local time zone of the process, which shifts the wall
+// clocks skipped or repeated by its daylight saving time transitions.
+var textTypes = map[string]bool{
+	"date":                     true,
+	"timestamp":                true,
+	"timestamp with time zone": true,
+}
+
+// textRows are rows whose columns of text types report the types sent by
+// Trino instead of varchar, with their precision.
+type textRows struct {
+	trinoRows
+	types      map[int]string
+	precisions map[int]int64
+}
+
+// withTextTypes returns the rows with the columns of text types reporting
+// their Trino type, given the types sent by Trino.
+func withTextTypes(rows trinoRows, trinoTypes []string) trinoRows {
+	r := &textRows{trinoRows: rows, types: map[int]string{}, precisions: map[int]int64{}}
+	for i, trinoType := range trinoTypes {
+		name, precision, hasPrecision := splitPrecision(trinoType)
+		if !textTypes[name] {
+			continue
+		}
+		r.types[i] = strings.ToUpper(name)
+		if hasPrecision {
+			r.precisions[i] = precision
+		}
+	}
+	if len(r.types) == 0 {
+		return rows
+	}
+	return r
+}
+
+// splitPrecision returns the name and the precision of a type like
+// timestamp(3) with time zone.
+func splitPrecision(typeName string) (string, int64, bool) {
+	start := strings.IndexByte(typeName, '(')
+	end := strings.IndexByte(typeName, ')')
+	if start < 0 || end < start {
+		return typeName, 0, false
+	}
+	precision, err := strconv.ParseInt(typeName[start+1:end], 10, 64)
+	if err != nil {
+		return typeName, 0, false
+	}
+	return typeName[:start] + typeName[end+1:], precision, true
+}
+
+func (r *textRows) ColumnTypeDatabaseTypeName(index int) string {
+	if typeName, ok := r.types[index]; ok {
+		return typeName
+	}
+	return r.trinoRows.ColumnTypeDatabaseTypeName(index)
+}
+
+func (r *textRows) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	if _, ok := r.types[index]; ok {
+		precision, ok := r.precisions[index]
+		return precision, 0, ok
+	}
+	return r.trinoRows.ColumnTypePrecisionScale(index)
+}
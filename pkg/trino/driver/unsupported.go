@@ -0,0 +1,80 @@
+package driver
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// supportedTypes maps the Trino types which the client doesn't support to
+// the types their values are read as. The sketch types are sent as base64
+// encoded binary values, like varbinary values, and ipprefix values as
+// strings, like varchar values. The textTypes are supported, but read as
+// varchar too.
+var supportedTypes = map[string]string{
+	"HyperLogLog":              "varbinary",
+	"P4HyperLogLog":            "varbinary",
+	"qdigest":                  "varbinary",
+	"tdigest":                  "varbinary",
+	"ipprefix":                 "varchar",
+	"date":                     "varchar",
+	"timestamp":                "varchar",
+	"timestamp with time zone": "varchar",
+}
+
+// rewriteUnsupportedColumns returns the response with its columns of
+// unsupported types changed to columns of supported types. Only the columns
+// are decoded and rewritten, the rest of the response, like its data, is
+// copied unchanged. Responses without columns of unsupported types are
+// returned unchanged.
+func rewriteUnsupportedColumns(body []byte, rawColumns json.RawMessage) []byte {
+	if len(rawColumns) == 0 {
+		return body
+	}
+	var columns []map[string]json.RawMessage
+	if err := json.Unmarshal(rawColumns, &columns); err != nil {
+		return body
+	}
+	rewrite := false
+	for _, column := range columns {
+		var signature struct {
+			RawType string `json:"rawType"`
+		}
+		if err := json.Unmarshal(column["typeSignature"], &signature); err != nil {
+			continue
+		}
+		if supported, ok := supportedType(signature.RawType); ok {
+			column["type"] = json.RawMessage(`"` + supported + `"`)
+			column["typeSignature"] = json.RawMessage(`{"rawType":"` + supported + `","arguments":[]}`)
+			rewrite = true
+		}
+	}
+	if !rewrite {
+		return body
+	}
+
+	start := bytes.Index(body, rawColumns)
+	if start < 0 {
+		return body
+	}
+	rewritten, err := json.Marshal(columns)
+	if err != nil {
+		return body
+	}
+	end := start + len(rawColumns)
+	result := make([]byte, 0, len(body)-len(rawColumns)+len(rewritten))
+	result = append(result, body[:start]...)
+	result = append(result, rewritten...)
+	return append(result, body[end:]...)
+}
+
+// supportedType returns the type the values of an unsupported type are read
+// as.
+func supportedType(rawType string) (string, bool) {
+	for name, supported := range supportedTypes {
+		if strings.EqualFold(rawType, name) {
+			return supported, true
+		}
+	}
+	return "", false
+}
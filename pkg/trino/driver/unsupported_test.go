@@ -0,0 +1,105 @@
+package driver
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestRewriteUnsupportedColumns(t *testing.T) {
+	body := []byte(`{"id":"query","columns":[` +
+		`{"name":"n","type":"bigint","typeSignature":{"rawType":"bigint","arguments":[]}},` +
+		`{"name":"hll","type":"HyperLogLog","typeSignature":{"rawType":"HyperLogLog","arguments":[]}},` +
+		`{"name":"digest","type":"qdigest(bigint)","typeSignature":{"rawType":"qdigest","arguments":[{"kind":"TYPE","value":{"rawType":"bigint","arguments":[]}}]}},` +
+		`{"name":"prefix","type":"ipprefix","typeSignature":{"rawType":"ipprefix","arguments":[]}},` +
+		`{"name":"ts","type":"timestamp(3) with time zone","typeSignature":{"rawType":"timestamp with time zone","arguments":[{"kind":"LONG","value":3}]}}` +
+		`],"data":[[1,"AgwBAIA=","AAE=","10.0.0.0/8","2024-03-31 02:30:00.000 Europe/Warsaw"]]}`)
+	rewrite := func(body []byte) []byte {
+		var response statementResponse
+		if err := json.Unmarshal(body, &response); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return rewriteUnsupportedColumns(body, response.Columns)
+	}
+
+	var results struct {
+		Columns []struct {
+			Name          string `json:"name"`
+			Type          string `json:"type"`
+			TypeSignature struct {
+				RawType string `json:"rawType"`
+			} `json:"typeSignature"`
+		} `json:"columns"`
+		Data [][]interface{} `json:"data"`
+	}
+	rewritten := rewrite(body)
+	if err := json.Unmarshal(rewritten, &results); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{"bigint", "varbinary", "varbinary", "varchar", "varchar"}
+	for i, column := range results.Columns {
+		if column.Type != want[i] || column.TypeSignature.RawType != want[i] {
+			t.Errorf("%s: got type %q and raw type %q, want %q", column.Name, column.Type, column.TypeSignature.RawType, want[i])
+		}
+	}
+	// Only the columns are rewritten.
+	data := body[bytes.Index(body, []byte(`],"data":`)):]
+	if !bytes.HasSuffix(rewritten, data) || !bytes.HasPrefix(rewritten, []byte(`{"id":"query","columns":[`)) {
+		t.Errorf("got %s, want the rest of the results unchanged", rewritten)
+	}
+
+	for _, unchanged := range []string{
+		`{"id":"query","columns":[{"name":"n","type":"bigint","typeSignature":{"rawType":"bigint","arguments":[]}}]}`,
+		`{"id":"query","data":[["2024-03-31 02:30:00.000 Europe/Warsaw"]]}`,
+	} {
+		if got := rewrite([]byte(unchanged)); string(got) != unchanged {
+			t.Errorf("got %s, want the results unchanged", got)
+		}
+	}
+}
+
+func TestWithTextTypes(t *testing.T) {
+	trinoTypes := []string{"bigint", "date", "timestamp(3)", "timestamp(6) with time zone", "array(timestamp(3))", "varchar"}
+	rows := withTextTypes(varcharRows{}, trinoTypes)
+
+	tests := []struct {
+		typeName     string
+		precision    int64
+		hasPrecision bool
+	}{
+		{typeName: "VARCHAR"},
+		{typeName: "DATE"},
+		{typeName: "TIMESTAMP", precision: 3, hasPrecision: true},
+		{typeName: "TIMESTAMP WITH TIME ZONE", precision: 6, hasPrecision: true},
+		{typeName: "VARCHAR"},
+		{typeName: "VARCHAR"},
+	}
+	for i, tt := range tests {
+		if got := rows.ColumnTypeDatabaseTypeName(i); got != tt.typeName {
+			t.Errorf("%s: got type %q, want %q", trinoTypes[i], got, tt.typeName)
+		}
+		if _, ok := rows.(*textRows).types[i]; !ok {
+			continue
+		}
+		precision, _, ok := rows.ColumnTypePrecisionScale(i)
+		if precision != tt.precision || ok != tt.hasPrecision {
+			t.Errorf("%s: got precision %d, %v, want %d, %v", trinoTypes[i], precision, ok, tt.precision, tt.hasPrecision)
+		}
+	}
+
+	plain := varcharRows{}
+	if got := withTextTypes(plain, []string{"bigint", "varchar"}); got != plain {
+		t.Errorf("got %T, want the rows unchanged without text types", got)
+	}
+}
+
+// varcharRows are rows whose columns are all varchar, like the columns of
+// text types read by the client.
+type varcharRows struct {
+	trinoRows
+}
+
+func (varcharRows) ColumnTypeDatabaseTypeName(int) string { return "VARCHAR" }
+
+func (varcharRows) ColumnTypePrecisionScale(int) (int64, int64, bool) { return 0, 0, false }
@@ -0,0 +1,297 @@
+package trino
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/trinodb/grafana-trino/pkg/trino/driver"
+	"github.com/trinodb/grafana-trino/pkg/trino/models"
+)
+
+// applyColumnTypes records the Trino types of the result columns in the
+// custom config of their fields, as "trinoType", and applies the settings
+// depending on them to the frames of a query.
+func applyColumnTypes(settings models.TrinoDatasourceSettings, frames data.Frames, columns []driver.Column) {
+	if len(columns) == 0 {
+		return
+	}
+	types := make(map[string]trinoType, len(columns))
+	byName := make(map[string]driver.Column, len(columns))
+	for _, column := range columns {
+		types[column.Name] = parseTrinoType(column.Type)
+		byName[column.Name] = column
+	}
+
+	for _, frame := range frames {
+		if frame == nil {
+			continue
+		}
+		for _, field := range frame.Fields {
+			column, ok := byName[field.Name]
+			if !ok {
+				continue
+			}
+			fieldConfig(field).Custom["trinoType"] = columnTrinoType(column)
+			switch {
+			case types[field.Name].name == "decimal" && column.HasPrecision:
+				setDecimalConfig(field, column)
+			case column.Type == intervalDayToSecond && !settings.IntervalAsString:
+				fieldConfig(field).Unit = "ms"
+			}
+		}
+		convertGeometries(frame, types)
+		if settings.FlattenRows {
+			flattenRows(frame, types)
+		}
+	}
+}
+
+// columnTrinoType returns the type of a column sent by Trino, e.g.
+// varchar(10) or timestamp(3) with time zone, or the type reported by the
+// driver if it wasn't recorded.
+func columnTrinoType(column driver.Column) string {
+	if column.TrinoType != "" {
+		return column.TrinoType
+	}
+	return strings.ToLower(column.Type)
+}
+
+// setDecimalConfig records the precision and scale of a decimal column in
+// the field config, and displays the values with the scale as decimals.
+func setDecimalConfig(field *data.Field, column driver.Column) {
+	config := fieldConfig(field)
+	if config.Decimals == nil {
+		decimals := uint16(column.Scale)
+		config.Decimals = &decimals
+	}
+	config.Custom["precision"] = column.Precision
+	config.Custom["scale"] = column.Scale
+}
+
+// fieldConfig returns the config of a field, with its custom config, adding
+// them if needed.
+func fieldConfig(field *data.Field) *data.FieldConfig {
+	if field.Config == nil {
+		field.Config = &data.FieldConfig{}
+	}
+	if field.Config.Custom == nil {
+		field.Config.Custom = map[string]interface{}{}
+	}
+	return field.Config
+}
+
+// flattenRows replaces the fields of row columns with named fields by a
+// field per row field, named after the column and the row field, e.g.
+// "point.x". Nested rows are flattened as well.
+func flattenRows(frame *data.Frame, types map[string]trinoType) {
+	fields := make([]*data.Field, 0, len(frame.Fields))
+	for _, field := range frame.Fields {
+		t, ok := types[field.Name]
+		if !ok || !t.namedFields() || field.Type() != data.FieldTypeNullableJSON {
+			fields = append(fields, field)
+			continue
+		}
+
+		rows := make([]map[string]interface{}, field.Len())
+		for i := range rows {
+			raw, ok := field.At(i).(*json.RawMessage)
+			if !ok || raw == nil {
+				continue
+			}
+			decoder := json.NewDecoder(bytes.NewReader(*raw))
+			decoder.UseNumber()
+			if err := decoder.Decode(&rows[i]); err != nil {
+				rows[i] = nil
+			}
+		}
+
+		for _, rowField := range rowFields(field.Name, t, rows) {
+			rowField.Labels = field.Labels
+			fields = append(fields, rowField)
+		}
+	}
+	frame.Fields = fields
+}
+
+func rowFields(name string, t trinoType, rows []map[string]interface{}) []*data.Field {
+	var fields []*data.Field
+	for i, param := range t.params {
+		fieldName := name + "." + param.field
+		values := make([]interface{}, len(rows))
+		for j, row := range rows {
+			if row != nil {
+				values[j] = row[param.field]
+			}
+		}
+
+		fieldType := t.param(i)
+		if fieldType.namedFields() {
+			nested := make([]map[string]interface{}, len(values))
+			for j, value := range values {
+				nested[j], _ = value.(map[string]interface{})
+			}
+			fields = append(fields, rowFields(fieldName, fieldType, nested)...)
+			continue
+		}
+		fields = append(fields, data.NewField(fieldName, nil, rowFieldValues(fieldType, values)))
+	}
+	return fields
+}
+
+// rowFieldValues converts the JSON values of a row field to a nullable slice
+// for a field of the row field type.
+func rowFieldValues(t trinoType, values []interface{}) interface{} {
+	switch t.name {
+	case "boolean":
+		out := make([]*bool, len(values))
+		for i, value := range values {
+			if b, ok := value.(bool); ok {
+				out[i] = &b
+			}
+		}
+		return out
+	case "tinyint", "smallint", "integer", "bigint":
+		out := make([]*int64, len(values))
+		for i, value := range values {
+			if n, ok := value.(json.Number); ok {
+				if v, err := n.Int64(); err == nil {
+					out[i] = &v
+				}
+			}
+		}
+		return out
+	case "real", "double":
+		out := make([]*float64, len(values))
+		for i, value := range values {
+			var s string
+			switch v := value.(type) {
+			case json.Number:
+				s = v.String()
+			case string:
+				// NaN and infinities are strings.
+				s = v
+			default:
+				continue
+			}
+			if v, err := strconv.ParseFloat(s, 64); err == nil {
+				out[i] = &v
+			}
+		}
+		return out
+	case "date", "timestamp", "timestamp with time zone":
+		out := make([]*time.Time, len(values))
+		for i, value := range values {
+			if s, ok := value.(string); ok {
+				if t, err := parseTimestamp(s); err == nil {
+					out[i] = &t
+				}
+			}
+		}
+		return out
+	case "array", "map", "row":
+		out := make([]*json.RawMessage, len(values))
+		for i, value := range values {
+			if value == nil {
+				continue
+			}
+			if b, err := json.Marshal(value); err == nil {
+				raw := json.RawMessage(b)
+				out[i] = &raw
+			}
+		}
+		return out
+	default:
+		out := make([]*string, len(values))
+		for i, value := range values {
+			switch v := value.(type) {
+			case string:
+				out[i] = &v
+			case json.Number:
+				s := v.String()
+				out[i] = &s
+			case nil:
+			default:
+				if b, err := json.Marshal(v); err == nil {
+					s := string(b)
+					out[i] = &s
+				}
+			}
+		}
+		return out
+	}
+}
+
+// setQueryInfo records the Trino query ID, with a link to the query in the
+// web UI of the coordinator, and its execution statistics in the metadata of
+// the frames of a query. Grafana shows the link with a notice on the first
+// frame.
+func setQueryInfo(frames data.Frames, query driver.QueryInfo) {
+	if query.ID == "" {
+		return
+	}
+	linked := query.InfoURI == ""
+	for _, frame := range frames {
+		if frame == nil {
+			continue
+		}
+		if frame.Meta == nil {
+			frame.Meta = &data.FrameMeta{}
+		}
+		custom, ok := frame.Meta.Custom.(map[string]interface{})
+		if !ok {
+			custom = map[string]interface{}{}
+		}
+		custom["queryId"] = query.ID
+		custom["queryUrl"] = query.InfoURI
+		custom["queryState"] = query.Stats.State
+		frame.Meta.Custom = custom
+		frame.Meta.Stats = append(frame.Meta.Stats,
+			queryStat("Queued time", "ms", query.Stats.QueuedTimeMillis),
+			queryStat("Elapsed time", "ms", query.Stats.ElapsedTimeMillis),
+			queryStat("CPU time", "ms", query.Stats.CPUTimeMillis),
+			queryStat("Processed rows", "short", query.Stats.ProcessedRows),
+			queryStat("Processed bytes", "bytes", query.Stats.ProcessedBytes),
+			queryStat("Peak memory", "bytes", query.Stats.PeakMemoryBytes),
+		)
+		if !linked {
+			frame.Meta.Notices = append(frame.Meta.Notices, data.Notice{
+				Severity: data.NoticeSeverityInfo,
+				Text:     "Trino query " + query.ID,
+				Link:     query.InfoURI,
+			})
+			linked = true
+		}
+	}
+}
+
+func queryStat(name, unit string, value int64) data.QueryStat {
+	return data.QueryStat{
+		FieldConfig: data.FieldConfig{DisplayName: name, Unit: unit},
+		Value:       float64(value),
+	}
+}
+
+// setTruncationNotice warns that the results of a query reached a limit, on
+// its first frame.
+func setTruncationNotice(frames data.Frames, notice string) {
+	if notice == "" {
+		return
+	}
+	for _, frame := range frames {
+		if frame == nil {
+			continue
+		}
+		if frame.Meta == nil {
+			frame.Meta = &data.FrameMeta{}
+		}
+		frame.Meta.Notices = append(frame.Meta.Notices, data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     notice,
+		})
+		return
+	}
+}
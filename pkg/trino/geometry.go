@@ -0,0 +1,305 @@
+package trino
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
+)
+
+// geometryConverter reads the values of the Geometry and SphericalGeography
+// types, which the driver returns as WKT, as strings. They are converted to
+// coordinates or GeoJSON by convertGeometries.
+func geometryConverter(typeName string) sqlutil.Converter {
+	converter := sqlutil.NullStringConverter
+	converter.Name = "trino " + strings.ToLower(typeName)
+	converter.InputTypeName = typeName
+	return converter
+}
+
+// convertGeometries replaces the fields of geometry columns, for the Geomap
+// panel: columns of points by latitude and longitude fields, named
+// "latitude" and "longitude" unless these names are taken, and other
+// columns by GeoJSON geometries.
+func convertGeometries(frame *data.Frame, types map[string]trinoType) {
+	names := make(map[string]bool, len(frame.Fields))
+	for _, field := range frame.Fields {
+		names[field.Name] = true
+	}
+
+	fields := make([]*data.Field, 0, len(frame.Fields))
+	for _, field := range frame.Fields {
+		t, ok := types[field.Name]
+		if !ok || t.name != "geometry" && t.name != "sphericalgeography" || field.Type() != data.FieldTypeNullableString {
+			fields = append(fields, field)
+			continue
+		}
+
+		geometries := make([]*geoJSON, field.Len())
+		points := true
+		for i := range geometries {
+			wkt, ok := field.At(i).(*string)
+			if !ok || wkt == nil {
+				continue
+			}
+			geometry, err := parseWKT(*wkt)
+			if err != nil {
+				// Keep the WKT of columns that can't be parsed.
+				points = false
+				geometries = nil
+				break
+			}
+			geometries[i] = geometry
+			if geometry != nil && geometry.Type != "Point" {
+				points = false
+			}
+		}
+
+		switch {
+		case geometries == nil:
+			fields = append(fields, field)
+		case points:
+			latitude, longitude := "latitude", "longitude"
+			if names[latitude] || names[longitude] {
+				latitude, longitude = field.Name+".latitude", field.Name+".longitude"
+			}
+			names[latitude], names[longitude] = true, true
+			fields = append(fields, pointFields(field, geometries, latitude, longitude)...)
+		default:
+			fields = append(fields, geoJSONField(field, geometries))
+		}
+	}
+	frame.Fields = fields
+}
+
+func pointFields(field *data.Field, points []*geoJSON, latitudeName, longitudeName string) []*data.Field {
+	latitudes := make([]*float64, len(points))
+	longitudes := make([]*float64, len(points))
+	for i, point := range points {
+		if point == nil {
+			continue
+		}
+		coordinates := point.Coordinates.([]float64)
+		longitudes[i], latitudes[i] = &coordinates[0], &coordinates[1]
+	}
+	latitude := data.NewField(latitudeName, field.Labels, latitudes)
+	latitude.Config = copyConfig(field.Config)
+	longitude := data.NewField(longitudeName, field.Labels, longitudes)
+	longitude.Config = copyConfig(field.Config)
+	return []*data.Field{latitude, longitude}
+}
+
+// copyConfig returns a copy of a field config, with its custom config, so
+// that the fields converted from the same column can be configured apart.
+func copyConfig(config *data.FieldConfig) *data.FieldConfig {
+	if config == nil {
+		return nil
+	}
+	copied := *config
+	if config.Custom != nil {
+		copied.Custom = make(map[string]interface{}, len(config.Custom))
+		for key, value := range config.Custom {
+			copied.Custom[key] = value
+		}
+	}
+	return &copied
+}
+
+func geoJSONField(field *data.Field, geometries []*geoJSON) *data.Field {
+	values := make([]*string, len(geometries))
+	for i, geometry := range geometries {
+		if geometry == nil {
+			continue
+		}
+		if b, err := json.Marshal(geometry); err == nil {
+			s := string(b)
+			values[i] = &s
+		}
+	}
+	geoJSON := data.NewField(field.Name, field.Labels, values)
+	geoJSON.Config = field.Config
+	return geoJSON
+}
+
+// geoJSON is a GeoJSON geometry.
+type geoJSON struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates,omitempty"`
+	Geometries  []*geoJSON  `json:"geometries,omitempty"`
+}
+
+var geoJSONTypes = map[string]string{
+	"POINT":              "Point",
+	"LINESTRING":         "LineString",
+	"POLYGON":            "Polygon",
+	"MULTIPOINT":         "MultiPoint",
+	"MULTILINESTRING":    "MultiLineString",
+	"MULTIPOLYGON":       "MultiPolygon",
+	"GEOMETRYCOLLECTION": "GeometryCollection",
+}
+
+// parseWKT parses a geometry in the well-known text format to its GeoJSON
+// geometry. Empty points are returned as nil.
+func parseWKT(wkt string) (*geoJSON, error) {
+	p := &wktParser{wkt: wkt}
+	geometry, err := p.geometry()
+	if err != nil {
+		return nil, err
+	}
+	if token := p.next(); token != "" {
+		return nil, fmt.Errorf("invalid WKT %q: unexpected %q", wkt, token)
+	}
+	return geometry, nil
+}
+
+type wktParser struct {
+	wkt string
+	pos int
+}
+
+// next returns the next token: a parenthesis, a comma, or a word or number.
+func (p *wktParser) next() string {
+	for p.pos < len(p.wkt) && p.wkt[p.pos] == ' ' {
+		p.pos++
+	}
+	if p.pos == len(p.wkt) {
+		return ""
+	}
+	start := p.pos
+	if c := p.wkt[p.pos]; c == '(' || c == ')' || c == ',' {
+		p.pos++
+		return p.wkt[start:p.pos]
+	}
+	for p.pos < len(p.wkt) && !strings.ContainsRune(" (),", rune(p.wkt[p.pos])) {
+		p.pos++
+	}
+	return p.wkt[start:p.pos]
+}
+
+func (p *wktParser) peek() string {
+	pos := p.pos
+	token := p.next()
+	p.pos = pos
+	return token
+}
+
+func (p *wktParser) geometry() (*geoJSON, error) {
+	keyword := strings.ToUpper(p.next())
+	geometryType, ok := geoJSONTypes[keyword]
+	if !ok {
+		return nil, fmt.Errorf("invalid WKT %q: unknown geometry %q", p.wkt, keyword)
+	}
+	switch strings.ToUpper(p.peek()) {
+	case "Z", "M", "ZM":
+		p.next()
+	}
+	if strings.EqualFold(p.peek(), "EMPTY") {
+		p.next()
+		if geometryType == "Point" {
+			return nil, nil
+		}
+		return &geoJSON{Type: geometryType, Coordinates: []interface{}{}}, nil
+	}
+
+	if geometryType == "GeometryCollection" {
+		return p.collection()
+	}
+	coordinates, err := p.list()
+	if err != nil {
+		return nil, err
+	}
+
+	geometry := &geoJSON{Type: geometryType, Coordinates: coordinates}
+	switch geometryType {
+	case "Point":
+		if len(coordinates) != 1 {
+			return nil, fmt.Errorf("invalid WKT %q: a point has one position", p.wkt)
+		}
+		geometry.Coordinates = coordinates[0]
+	case "MultiPoint":
+		// The points of multipoints may be parenthesized.
+		for i, point := range coordinates {
+			if nested, ok := point.([]interface{}); ok && len(nested) == 1 {
+				coordinates[i] = nested[0]
+			}
+		}
+	}
+	return geometry, nil
+}
+
+func (p *wktParser) collection() (*geoJSON, error) {
+	collection := &geoJSON{Type: "GeometryCollection"}
+	if p.next() != "(" {
+		return nil, fmt.Errorf("invalid WKT %q: expected (", p.wkt)
+	}
+	for {
+		geometry, err := p.geometry()
+		if err != nil {
+			return nil, err
+		}
+		if geometry != nil {
+			collection.Geometries = append(collection.Geometries, geometry)
+		}
+		switch p.next() {
+		case ",":
+		case ")":
+			return collection, nil
+		default:
+			return nil, fmt.Errorf("invalid WKT %q: expected , or )", p.wkt)
+		}
+	}
+}
+
+// list parses a parenthesized list of positions or of nested lists.
+func (p *wktParser) list() ([]interface{}, error) {
+	if p.next() != "(" {
+		return nil, fmt.Errorf("invalid WKT %q: expected (", p.wkt)
+	}
+	var elements []interface{}
+	for {
+		if p.peek() == "(" {
+			nested, err := p.list()
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, nested)
+		} else {
+			position, err := p.position()
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, position)
+		}
+		switch p.next() {
+		case ",":
+		case ")":
+			return elements, nil
+		default:
+			return nil, fmt.Errorf("invalid WKT %q: expected , or )", p.wkt)
+		}
+	}
+}
+
+// position parses the coordinates of a position, e.g. "21.01 52.23".
+func (p *wktParser) position() ([]float64, error) {
+	var position []float64
+	for {
+		token := p.peek()
+		if token == "" || token == "," || token == ")" || token == "(" {
+			break
+		}
+		p.next()
+		v, err := strconv.ParseFloat(token, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid WKT %q: invalid coordinate %q", p.wkt, token)
+		}
+		position = append(position, v)
+	}
+	if len(position) < 2 {
+		return nil, fmt.Errorf("invalid WKT %q: a position has at least two coordinates", p.wkt)
+	}
+	return position, nil
+}
@@ -0,0 +1,45 @@
+package trino
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseWKT(t *testing.T) {
+	for _, tt := range []struct {
+		wkt  string
+		want string
+	}{
+		{wkt: "POINT (21.01 52.23)", want: `{"type":"Point","coordinates":[21.01,52.23]}`},
+		{wkt: "POINT Z (1 2 3)", want: `{"type":"Point","coordinates":[1,2,3]}`},
+		{wkt: "POINT EMPTY", want: `null`},
+		{wkt: "LINESTRING (0 0, 1 1.5)", want: `{"type":"LineString","coordinates":[[0,0],[1,1.5]]}`},
+		{wkt: "POLYGON ((0 0, 1 0, 1 1, 0 0), (0.2 0.2, 0.4 0.2, 0.4 0.4, 0.2 0.2))", want: `{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,0]],[[0.2,0.2],[0.4,0.2],[0.4,0.4],[0.2,0.2]]]}`},
+		{wkt: "MULTIPOINT (1 2, 3 4)", want: `{"type":"MultiPoint","coordinates":[[1,2],[3,4]]}`},
+		{wkt: "MULTIPOINT ((1 2), (3 4))", want: `{"type":"MultiPoint","coordinates":[[1,2],[3,4]]}`},
+		{wkt: "MULTILINESTRING ((0 0, 1 1), (2 2, 3 3))", want: `{"type":"MultiLineString","coordinates":[[[0,0],[1,1]],[[2,2],[3,3]]]}`},
+		{wkt: "MULTIPOLYGON (((0 0, 1 0, 1 1, 0 0)), ((2 2, 3 2, 3 3, 2 2)))", want: `{"type":"MultiPolygon","coordinates":[[[[0,0],[1,0],[1,1],[0,0]]],[[[2,2],[3,2],[3,3],[2,2]]]]}`},
+		{wkt: "LINESTRING EMPTY", want: `{"type":"LineString","coordinates":[]}`},
+		{wkt: "GEOMETRYCOLLECTION (POINT (1 2), LINESTRING (0 0, 1 1))", want: `{"type":"GeometryCollection","geometries":[{"type":"Point","coordinates":[1,2]},{"type":"LineString","coordinates":[[0,0],[1,1]]}]}`},
+		{wkt: "point(-1e2 2)", want: `{"type":"Point","coordinates":[-100,2]}`},
+	} {
+		geometry, err := parseWKT(tt.wkt)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.wkt, err)
+			continue
+		}
+		got, err := json.Marshal(geometry)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.wkt, got, tt.want)
+		}
+	}
+
+	for _, wkt := range []string{"", "CIRCLE (0 0)", "POINT (1)", "POINT (1 2", "POINT (1 2) 3", "LINESTRING (0 0, a 1)", "POINT (1 2, 3 4)"} {
+		if _, err := parseWKT(wkt); err == nil {
+			t.Errorf("%q: expected an error", wkt)
+		}
+	}
+}
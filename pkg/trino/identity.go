@@ -0,0 +1,143 @@
+package trino
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	trinoClient "github.com/trinodb/grafana-trino/pkg/trino/client"
+	"github.com/trinodb/grafana-trino/pkg/trino/models"
+)
+
+// mapTrinoUser returns the Trino user to impersonate for the Grafana user,
+// according to the data source user mapping.
+func mapTrinoUser(settings models.TrinoDatasourceSettings, user *backend.User) (string, error) {
+	var trinoUser string
+	switch settings.UserMapping {
+	case models.UserMappingEmail:
+		trinoUser = user.Email
+	case models.UserMappingEmailLocalPart:
+		trinoUser, _, _ = strings.Cut(user.Email, "@")
+	case models.UserMappingRegex:
+		pattern, err := regexp.Compile(settings.UserMappingPattern)
+		if err != nil {
+			return "", fmt.Errorf("invalid user mapping pattern: %w", err)
+		}
+		match := pattern.FindStringSubmatchIndex(user.Login)
+		if match == nil {
+			return "", fmt.Errorf("Grafana user %q does not match the user mapping pattern", user.Login)
+		}
+		trinoUser = string(pattern.ExpandString(nil, settings.UserMappingReplacement, user.Login, match))
+	case models.UserMappingLookup:
+		var ok bool
+		trinoUser, ok = settings.UserMappingTable[user.Login]
+		if !ok {
+			return "", fmt.Errorf("Grafana user %q is not in the user mapping table", user.Login)
+		}
+	default:
+		trinoUser = user.Login
+	}
+
+	if trinoUser == "" {
+		return "", fmt.Errorf("Grafana user %q can't be mapped to a Trino user with the %s user mapping", user.Login, settings.UserMapping)
+	}
+	return trinoUser, nil
+}
+
+// orgRoleRanks ranks the Grafana org roles, each role having the
+// permissions of the lower ones.
+var orgRoleRanks = map[string]int{
+	"Viewer": 1,
+	"Editor": 2,
+	"Admin":  3,
+}
+
+// mapTrinoRoles returns the Trino roles for a query of the Grafana user. The
+// role rules are applied in order, the first rule granting a role for a
+// catalog wins, and catalogs without a matching rule keep the data source
+// roles. Org role rules match the users with that role or a higher one, e.g.
+// a Viewer rule matches editors and admins too. The teams header is trusted
+// as is, so team rules are only as safe as the proxy setting it.
+func mapTrinoRoles(settings models.TrinoDatasourceSettings, user *backend.User, headers http.Header) (map[string]string, error) {
+	roles, err := models.ParseRoles(settings.Roles)
+	if err != nil {
+		return nil, err
+	}
+
+	teams := map[string]bool{}
+	if settings.TeamsHeader != "" {
+		values := headers.Values(settings.TeamsHeader)
+		if len(values) == 0 && hasTeamRules(settings.RoleRules) {
+			log.DefaultLogger.Warn("The teams header is not forwarded to the data source, team rules match no teams", "header", settings.TeamsHeader)
+		}
+		for _, value := range values {
+			for _, team := range strings.Split(value, ",") {
+				teams[strings.TrimSpace(team)] = true
+			}
+		}
+	}
+
+	granted := map[string]bool{}
+	for _, rule := range settings.RoleRules {
+		matches := rule.Team != "" && teams[rule.Team]
+		if rule.OrgRole != "" {
+			matches = user != nil && orgRoleRanks[user.Role] >= orgRoleRanks[rule.OrgRole]
+		}
+		if !matches {
+			continue
+		}
+		ruleRoles, err := models.ParseRoles(rule.Roles)
+		if err != nil {
+			return nil, err
+		}
+		for catalog, role := range ruleRoles {
+			if !granted[catalog] {
+				roles[catalog] = role
+				granted[catalog] = true
+			}
+		}
+	}
+	return roles, nil
+}
+
+func hasTeamRules(rules []models.RoleRule) bool {
+	for _, rule := range rules {
+		if rule.Team != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenExchangeSubject returns the subject of the token exchange for the
+// Grafana user, identified by the Trino user when impersonation is enabled,
+// or else by the login. In the forwarded mode, the ID token forwarded by
+// Grafana is exchanged, or else the access token of the Authorization header,
+// which is the one last forwarded for the user when Grafana forwards none,
+// like for alert evaluations.
+func tokenExchangeSubject(settings models.TrinoDatasourceSettings, user *backend.User, trinoUser string, idToken string, authorization string) (trinoClient.Subject, error) {
+	if user == nil {
+		return trinoClient.Subject{}, fmt.Errorf("user can't be nil if token exchange is enabled")
+	}
+	subject := trinoClient.Subject{User: trinoUser}
+	if subject.User == "" {
+		subject.User = user.Login
+	}
+	if settings.TokenExchange != models.TokenExchangeForwarded {
+		return subject, nil
+	}
+
+	if idToken != "" {
+		subject.Token = idToken
+		subject.TokenType = trinoClient.TokenTypeIDToken
+	} else if accessToken, ok := strings.CutPrefix(authorization, bearerPrefix); ok && accessToken != "" {
+		subject.Token = accessToken
+		subject.TokenType = trinoClient.TokenTypeAccessToken
+	} else {
+		return trinoClient.Subject{}, fmt.Errorf("token exchange requires Grafana to forward the OAuth identity of user %q", user.Login)
+	}
+	return subject, nil
+}
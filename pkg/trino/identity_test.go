@@ -0,0 +1,192 @@
+package trino
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	trinoClient "github.com/trinodb/grafana-trino/pkg/trino/client"
+	"github.com/trinodb/grafana-trino/pkg/trino/models"
+)
+
+func TestMapTrinoUser(t *testing.T) {
+	alice := &backend.User{Login: "alice", Email: "alice.smith@example.com"}
+	serviceAccount := &backend.User{Login: "sa-1-dashboards"}
+
+	tests := []struct {
+		name     string
+		settings models.TrinoDatasourceSettings
+		user     *backend.User
+		want     string
+		wantErr  bool
+	}{
+		{name: "login", settings: models.TrinoDatasourceSettings{UserMapping: models.UserMappingLogin}, user: alice, want: "alice"},
+		{name: "unset mode uses the login", settings: models.TrinoDatasourceSettings{}, user: alice, want: "alice"},
+		{name: "email", settings: models.TrinoDatasourceSettings{UserMapping: models.UserMappingEmail}, user: alice, want: "alice.smith@example.com"},
+		{name: "email without email", settings: models.TrinoDatasourceSettings{UserMapping: models.UserMappingEmail}, user: serviceAccount, wantErr: true},
+		{name: "email local part", settings: models.TrinoDatasourceSettings{UserMapping: models.UserMappingEmailLocalPart}, user: alice, want: "alice.smith"},
+		{name: "email local part without email", settings: models.TrinoDatasourceSettings{UserMapping: models.UserMappingEmailLocalPart}, user: serviceAccount, wantErr: true},
+		{
+			name: "regex",
+			settings: models.TrinoDatasourceSettings{
+				UserMapping:            models.UserMappingRegex,
+				UserMappingPattern:     `^sa-\d+-(.+)$`,
+				UserMappingReplacement: "svc_$1",
+			},
+			user: serviceAccount,
+			want: "svc_dashboards",
+		},
+		{
+			name: "regex without match",
+			settings: models.TrinoDatasourceSettings{
+				UserMapping:            models.UserMappingRegex,
+				UserMappingPattern:     `^sa-\d+-(.+)$`,
+				UserMappingReplacement: "svc_$1",
+			},
+			user:    alice,
+			wantErr: true,
+		},
+		{
+			name: "regex with empty result",
+			settings: models.TrinoDatasourceSettings{
+				UserMapping:            models.UserMappingRegex,
+				UserMappingPattern:     `^(.*)$`,
+				UserMappingReplacement: "$2",
+			},
+			user:    alice,
+			wantErr: true,
+		},
+		{
+			name: "lookup",
+			settings: models.TrinoDatasourceSettings{
+				UserMapping:      models.UserMappingLookup,
+				UserMappingTable: map[string]string{"sa-1-dashboards": "dashboards"},
+			},
+			user: serviceAccount,
+			want: "dashboards",
+		},
+		{
+			name: "lookup of an unknown user",
+			settings: models.TrinoDatasourceSettings{
+				UserMapping:      models.UserMappingLookup,
+				UserMappingTable: map[string]string{"sa-1-dashboards": "dashboards"},
+			},
+			user:    alice,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mapTrinoUser(tt.settings, tt.user)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got Trino user %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMapTrinoRoles(t *testing.T) {
+	settings := models.TrinoDatasourceSettings{
+		Roles:       "system:reader",
+		TeamsHeader: "X-Grafana-Teams",
+		RoleRules: []models.RoleRule{
+			{Team: "data-engineering", Roles: "hive:engineer"},
+			{OrgRole: "Admin", Roles: "system:admin;hive:admin"},
+			{OrgRole: "Editor", Roles: "hive:writer"},
+			{OrgRole: "Viewer", Roles: "tpch:reader"},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		user  *backend.User
+		teams string
+		want  map[string]string
+	}{
+		{name: "no matching rule keeps the data source roles", user: &backend.User{Role: "None"}, want: map[string]string{"system": "reader"}},
+		{name: "org role", user: &backend.User{Role: "Viewer"}, want: map[string]string{"system": "reader", "tpch": "reader"}},
+		{name: "org role rules match higher roles", user: &backend.User{Role: "Editor"}, want: map[string]string{"system": "reader", "hive": "writer", "tpch": "reader"}},
+		{name: "org role overrides data source roles", user: &backend.User{Role: "Admin"}, want: map[string]string{"system": "admin", "hive": "admin", "tpch": "reader"}},
+		{name: "team", user: &backend.User{Role: "Viewer"}, teams: "analysts, data-engineering", want: map[string]string{"system": "reader", "hive": "engineer", "tpch": "reader"}},
+		{name: "first matching rule wins", user: &backend.User{Role: "Admin"}, teams: "data-engineering", want: map[string]string{"system": "admin", "hive": "engineer", "tpch": "reader"}},
+		{name: "no user", user: nil, teams: "data-engineering", want: map[string]string{"system": "reader", "hive": "engineer"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := http.Header{}
+			if tt.teams != "" {
+				headers.Set("X-Grafana-Teams", tt.teams)
+			}
+			got, err := mapTrinoRoles(settings, tt.user, headers)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenExchangeSubject(t *testing.T) {
+	alice := &backend.User{Login: "alice"}
+	client := models.TrinoDatasourceSettings{TokenExchange: models.TokenExchangeClient}
+	forwarded := models.TrinoDatasourceSettings{TokenExchange: models.TokenExchangeForwarded}
+
+	tests := []struct {
+		name      string
+		settings  models.TrinoDatasourceSettings
+		user      *backend.User
+		trinoUser string
+		// idToken and authorization are the forwarded ID token and
+		// Authorization header.
+		idToken       string
+		authorization string
+		want          trinoClient.Subject
+		wantErr       bool
+	}{
+		{name: "client token for the login", settings: client, user: alice, want: trinoClient.Subject{User: "alice"}},
+		{name: "client token for the Trino user", settings: client, user: alice, trinoUser: "svc_alice", want: trinoClient.Subject{User: "svc_alice"}},
+		{
+			name:          "forwarded ID token",
+			settings:      forwarded,
+			user:          alice,
+			idToken:       "id-token",
+			authorization: "Bearer access-token",
+			want:          trinoClient.Subject{User: "alice", Token: "id-token", TokenType: trinoClient.TokenTypeIDToken},
+		},
+		{
+			name:          "forwarded access token",
+			settings:      forwarded,
+			user:          alice,
+			authorization: "Bearer access-token",
+			want:          trinoClient.Subject{User: "alice", Token: "access-token", TokenType: trinoClient.TokenTypeAccessToken},
+		},
+		{name: "nothing forwarded", settings: forwarded, user: alice, wantErr: true},
+		{name: "no user", settings: client, user: nil, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tokenExchangeSubject(tt.settings, tt.user, tt.trinoUser, tt.idToken, tt.authorization)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("tokenExchangeSubject() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("tokenExchangeSubject() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
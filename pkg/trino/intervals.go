@@ -0,0 +1,114 @@
+package trino
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
+)
+
+const (
+	intervalDayToSecond = "INTERVAL DAY TO SECOND"
+	intervalYearToMonth = "INTERVAL YEAR TO MONTH"
+)
+
+// intervalConverter converts the values of an interval type, which the
+// driver returns as strings, to a number: milliseconds for intervals day to
+// second and months for intervals year to month. With asString, the values
+// are kept as strings.
+func intervalConverter(typeName string, asString bool) sqlutil.Converter {
+	if asString {
+		converter := sqlutil.NullStringConverter
+		converter.Name = "trino " + strings.ToLower(typeName) + " as string"
+		converter.InputTypeName = typeName
+		return converter
+	}
+
+	parse := parseIntervalYearToMonth
+	if typeName == intervalDayToSecond {
+		parse = parseIntervalDayToSecond
+	}
+	return sqlutil.Converter{
+		Name:          "trino " + strings.ToLower(typeName),
+		InputScanType: reflect.TypeOf(sql.NullString{}),
+		InputTypeName: typeName,
+		FrameConverter: sqlutil.FrameConverter{
+			FieldType: data.FieldTypeNullableInt64,
+			ConverterFunc: func(in interface{}) (interface{}, error) {
+				v := in.(*sql.NullString)
+				if !v.Valid {
+					return (*int64)(nil), nil
+				}
+				n, err := parse(v.String)
+				if err != nil {
+					return nil, err
+				}
+				return &n, nil
+			},
+		},
+	}
+}
+
+// parseIntervalDayToSecond returns the milliseconds of an interval day to
+// second, formatted as "[-]D HH:MM:SS.mmm".
+func parseIntervalDayToSecond(value string) (int64, error) {
+	s, negative := strings.CutPrefix(value, "-")
+	days, clock, ok := strings.Cut(s, " ")
+	if !ok {
+		return 0, fmt.Errorf("invalid interval day to second %q", value)
+	}
+	d, err := strconv.ParseInt(days, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid interval day to second %q", value)
+	}
+	parts := strings.Split(clock, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid interval day to second %q", value)
+	}
+	hours, err := strconv.ParseUint(parts[0], 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid interval day to second %q", value)
+	}
+	minutes, err := strconv.ParseUint(parts[1], 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid interval day to second %q", value)
+	}
+	seconds, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid interval day to second %q", value)
+	}
+
+	ms := d*24*60*60*1000 + int64(hours)*60*60*1000 + int64(minutes)*60*1000 + int64(math.Round(seconds*1000))
+	if negative {
+		ms = -ms
+	}
+	return ms, nil
+}
+
+// parseIntervalYearToMonth returns the months of an interval year to month,
+// formatted as "[-]Y-M".
+func parseIntervalYearToMonth(value string) (int64, error) {
+	s, negative := strings.CutPrefix(value, "-")
+	years, months, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, fmt.Errorf("invalid interval year to month %q", value)
+	}
+	y, err := strconv.ParseInt(years, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid interval year to month %q", value)
+	}
+	m, err := strconv.ParseInt(months, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid interval year to month %q", value)
+	}
+	n := y*12 + m
+	if negative {
+		n = -n
+	}
+	return n, nil
+}
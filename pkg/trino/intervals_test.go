@@ -0,0 +1,100 @@
+package trino
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func TestParseIntervalDayToSecond(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+	}{
+		{value: "0 00:00:00.000", want: 0},
+		{value: "0 00:00:01.500", want: 1500},
+		{value: "1 02:03:04.567", want: 93784567},
+		{value: "-1 02:03:04.567", want: -93784567},
+		{value: "365000 00:00:00.001", want: 31536000000001},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseIntervalDayToSecond(tt.value)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"", "1", "1 02:03", "x 02:03:04.000", "1 02:03:xx"} {
+		if _, err := parseIntervalDayToSecond(invalid); err == nil {
+			t.Errorf("expected an error parsing %q", invalid)
+		}
+	}
+}
+
+func TestParseIntervalYearToMonth(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+	}{
+		{value: "0-0", want: 0},
+		{value: "1-2", want: 14},
+		{value: "-1-2", want: -14},
+		{value: "0-11", want: 11},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseIntervalYearToMonth(tt.value)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"", "1", "a-1", "1-b"} {
+		if _, err := parseIntervalYearToMonth(invalid); err == nil {
+			t.Errorf("expected an error parsing %q", invalid)
+		}
+	}
+}
+
+func TestConverters_Intervals(t *testing.T) {
+	result := fakeResult{
+		columns: []string{"elapsed", "age"},
+		types:   []string{"interval day to second", "interval year to month"},
+		rows:    [][]interface{}{{"0 00:01:30.250", "2-3"}, {nil, nil}},
+	}
+
+	t.Run("numbers", func(t *testing.T) {
+		frame := convertResult(t, `{}`, result)
+		for i, want := range []int64{90250, 27} {
+			field := frame.Fields[i]
+			if field.Type() != data.FieldTypeNullableInt64 {
+				t.Fatalf("%s: got field type %s, want %s", field.Name, field.Type(), data.FieldTypeNullableInt64)
+			}
+			if got, _ := field.ConcreteAt(0); got != want {
+				t.Errorf("%s: got %v, want %d", field.Name, got, want)
+			}
+			if _, ok := field.ConcreteAt(1); ok {
+				t.Errorf("%s: expected NULL", field.Name)
+			}
+		}
+	})
+
+	t.Run("strings", func(t *testing.T) {
+		frame := convertResult(t, `{"intervalAsString": true}`, result)
+		for i, want := range []string{"0 00:01:30.250", "2-3"} {
+			field := frame.Fields[i]
+			if got, _ := field.ConcreteAt(0); got != want {
+				t.Errorf("%s: got %v, want %s", field.Name, got, want)
+			}
+		}
+	})
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// TrinoQuery holds the Trino specific fields of a query model, next to the
+// fields read by sqlutil.GetQuery.
+type TrinoQuery struct {
+	// SessionProperties override the data source session properties for a
+	// single query.
+	SessionProperties map[string]string `json:"sessionProperties"`
+	// Catalog and Schema override the data source default catalog and schema
+	// used to resolve unqualified table names.
+	Catalog string `json:"catalog"`
+	Schema  string `json:"schema"`
+	// Timeout overrides the data source query timeout, in seconds.
+	Timeout int `json:"timeout"`
+	// MaxRows and MaxResultBytes override the data source result limits, up
+	// to their ceilings.
+	MaxRows        int64 `json:"maxRows"`
+	MaxResultBytes int64 `json:"maxResultBytes"`
+}
+
+func (q *TrinoQuery) Load(query backend.DataQuery) error {
+	err := json.Unmarshal(query.JSON, q)
+	if err != nil {
+		return err
+	}
+	if q.Timeout < 0 {
+		return errors.New("timeout must not be negative")
+	}
+	if q.MaxRows < 0 || q.MaxResultBytes < 0 {
+		return errors.New("result limits must not be negative")
+	}
+	return ValidateSessionProperties(q.SessionProperties)
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestTrinoQuery_Load(t *testing.T) {
+	query := TrinoQuery{}
+	err := query.Load(backend.DataQuery{JSON: []byte(`{"rawSql": "SELECT 1", "sessionProperties": {"join_distribution_type": "BROADCAST"}}`)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{"join_distribution_type": "BROADCAST"}
+	if !reflect.DeepEqual(query.SessionProperties, want) {
+		t.Errorf("got session properties %v, want %v", query.SessionProperties, want)
+	}
+}
+
+func TestTrinoQuery_LoadRejectsInvalidSessionProperties(t *testing.T) {
+	query := TrinoQuery{}
+	err := query.Load(backend.DataQuery{JSON: []byte(`{"sessionProperties": {"not a property": "x"}}`)})
+	if err == nil {
+		t.Fatal("expected an invalid session property error")
+	}
+}
+
+func TestTrinoQuery_LoadTimeout(t *testing.T) {
+	query := TrinoQuery{}
+	if err := query.Load(backend.DataQuery{JSON: []byte(`{"timeout": 30}`)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if query.Timeout != 30 {
+		t.Errorf("got timeout %d, want 30", query.Timeout)
+	}
+	if err := query.Load(backend.DataQuery{JSON: []byte(`{"timeout": -1}`)}); err == nil {
+		t.Error("expected a negative timeout error")
+	}
+}
+
+func TestTrinoQuery_LoadRejectsNegativeLimits(t *testing.T) {
+	query := TrinoQuery{}
+	if err := query.Load(backend.DataQuery{JSON: []byte(`{"maxRows": -1}`)}); err == nil {
+		t.Error("expected a negative limit error")
+	}
+}
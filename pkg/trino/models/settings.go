@@ -6,13 +6,50 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/httpclient"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
 )
 
+// User mapping modes select how the Trino user is derived from the Grafana
+// user when impersonation is enabled.
+const (
+	UserMappingLogin          = "login"
+	UserMappingEmail          = "email"
+	UserMappingEmailLocalPart = "emailLocalPart"
+	UserMappingRegex          = "regex"
+	UserMappingLookup         = "lookup"
+)
+
+// Token auth methods select how the client authenticates to the OAuth token
+// endpoint.
+const (
+	TokenAuthClientSecretPost  = "client_secret_post"
+	TokenAuthClientSecretBasic = "client_secret_basic"
+	TokenAuthPrivateKeyJWT     = "private_key_jwt"
+)
+
+// Token exchange modes select which token the OAuth client exchanges for a
+// token of each Grafana user.
+const (
+	TokenExchangeClient    = "client"
+	TokenExchangeForwarded = "forwarded"
+)
+
+// Binary encodings select how varbinary and sketch values are rendered.
+const (
+	BinaryEncodingHex    = "hex"
+	BinaryEncodingBase64 = "base64"
+	BinaryEncodingUTF8   = "utf8"
+)
+
 type TrinoDatasourceSettings struct {
+	UID                 string             `json:"-"`
+	Updated             time.Time          `json:"-"`
 	URL                 *url.URL           `json:"-"`
 	Opts                httpclient.Options `json:"-"`
 	EnableImpersonation bool               `json:"enableImpersonation"`
@@ -23,6 +60,85 @@ type TrinoDatasourceSettings struct {
 	ImpersonationUser   string             `json:"impersonationUser"`
 	Roles               string             `json:"roles"`
 	ClientTags          string             `json:"clientTags"`
+	SessionProperties   map[string]string  `json:"sessionProperties"`
+	DefaultCatalog      string             `json:"defaultCatalog"`
+	DefaultSchema       string             `json:"defaultSchema"`
+	// UserMapping is one of the user mapping modes, defaulting to the login.
+	// The regex mode rewrites the login matching UserMappingPattern to
+	// UserMappingReplacement, the lookup mode maps logins with
+	// UserMappingTable.
+	UserMapping            string            `json:"userMapping"`
+	UserMappingPattern     string            `json:"userMappingPattern"`
+	UserMappingReplacement string            `json:"userMappingReplacement"`
+	UserMappingTable       map[string]string `json:"userMappingTable"`
+	// RoleRules derive the Trino roles of each query from the org role or
+	// teams of the requesting Grafana user. Org role rules match that role
+	// and the higher ones. Teams are read from the comma-separated
+	// TeamsHeader request header, which Grafana doesn't verify: it must be
+	// set by a trusted authentication proxy that removes the values sent by
+	// clients, and forwarded by Grafana to the data source.
+	RoleRules   []RoleRule `json:"roleRules"`
+	TeamsHeader string     `json:"teamsHeader"`
+	// ReadOnly rejects queries other than SELECT, WITH, SHOW, DESCRIBE,
+	// EXPLAIN and VALUES statements.
+	ReadOnly bool `json:"readOnly"`
+	// FlattenRows returns a field per field of row columns, named after the
+	// column and the row field, instead of a JSON field.
+	FlattenRows bool `json:"flattenRows"`
+	// DecimalAsString returns decimal columns as strings instead of float64
+	// values, for values that need more precision.
+	DecimalAsString bool `json:"decimalAsString"`
+	// IntervalAsString returns interval columns as strings instead of
+	// milliseconds and months.
+	IntervalAsString bool `json:"intervalAsString"`
+	// BinaryEncoding is one of the binary encodings, defaulting to hex. The
+	// UTF-8 encoding replaces invalid sequences with the replacement
+	// character.
+	BinaryEncoding string `json:"binaryEncoding"`
+	// QueryTimeout is the timeout of queries in seconds, unless overridden
+	// by the query. Zero means no timeout.
+	QueryTimeout int `json:"queryTimeout"`
+	// MaxRows and MaxResultBytes limit the results of queries, unless
+	// overridden by the query, up to MaxRowsCeiling and
+	// MaxResultBytesCeiling. Results exceeding a limit are truncated. Zero
+	// means no limit.
+	MaxRows               int64 `json:"maxRows"`
+	MaxResultBytes        int64 `json:"maxResultBytes"`
+	MaxRowsCeiling        int64 `json:"maxRowsCeiling"`
+	MaxResultBytesCeiling int64 `json:"maxResultBytesCeiling"`
+	// Scopes, separated by spaces, Audience and Resource are sent with the
+	// OAuth client credentials token request, as required by some identity
+	// providers, with the extra form parameters of TokenParams.
+	Scopes      string            `json:"scopes"`
+	Audience    string            `json:"audience"`
+	Resource    string            `json:"resource"`
+	TokenParams map[string]string `json:"tokenParams"`
+	// IssuerUrl is the URL of the OpenID provider, used to discover the
+	// token endpoint instead of setting TokenUrl.
+	IssuerUrl string `json:"issuerUrl"`
+	// TokenAuthMethod is one of the token auth methods, defaulting to
+	// client_secret_post. The private_key_jwt method signs client
+	// assertions with the ClientPrivateKey, identified by ClientKeyId.
+	TokenAuthMethod  string `json:"tokenAuthMethod"`
+	ClientKeyId      string `json:"clientKeyId"`
+	ClientPrivateKey string `json:"-"`
+	// TokenExchange is one of the token exchange modes. When set, the OAuth
+	// client exchanges the client token, with the user as requested
+	// subject, or the token of the user forwarded by Grafana for a token of
+	// the user, as described in RFC 8693. Empty disables the exchange.
+	TokenExchange string `json:"tokenExchange"`
+	// TokenExchangeUserParam is the parameter naming the user when the
+	// client token is exchanged. RFC 8693 has no such parameter: the
+	// default, requested_subject, is the one of Keycloak.
+	TokenExchangeUserParam string `json:"tokenExchangeUserParam"`
+}
+
+// RoleRule grants Trino roles, in the same "catalog:role;..." format as
+// Roles, to the Grafana users with the OrgRole or member of the Team.
+type RoleRule struct {
+	OrgRole string `json:"orgRole"`
+	Team    string `json:"team"`
+	Roles   string `json:"roles"`
 }
 
 func (s *TrinoDatasourceSettings) Load(ctx context.Context, config backend.DataSourceInstanceSettings) error {
@@ -34,7 +150,9 @@ func (s *TrinoDatasourceSettings) Load(ctx context.Context, config backend.DataS
 		return errors.New("Custom headers are not supported and must be not set")
 	}
 	log.DefaultLogger.Info("Loading Trino data source settings")
-	s.URL, err = parseHTTPURL(config.URL, "Trino URL")
+	s.UID = config.UID
+	s.Updated = config.Updated
+	s.URL, err = ParseHTTPURL(config.URL, "Trino URL")
 	if err != nil {
 		return err
 	}
@@ -53,22 +171,201 @@ func (s *TrinoDatasourceSettings) Load(ctx context.Context, config backend.DataS
 		return err
 	}
 	if s.TokenUrl != "" {
-		tokenURL, err := parseHTTPURL(s.TokenUrl, "OAuth token URL")
+		tokenURL, err := ParseHTTPURL(s.TokenUrl, "OAuth token URL")
 		if err != nil {
 			return err
 		}
 		s.TokenUrl = tokenURL.String()
 	}
+	if s.IssuerUrl != "" {
+		if s.TokenUrl != "" {
+			return errors.New("OAuth token URL and issuer URL must not both be set")
+		}
+		issuerURL, err := ParseHTTPURL(s.IssuerUrl, "OAuth issuer URL")
+		if err != nil {
+			return err
+		}
+		s.IssuerUrl = issuerURL.String()
+	}
+	err = ValidateSessionProperties(s.SessionProperties)
+	if err != nil {
+		return err
+	}
+	if s.DefaultSchema != "" && s.DefaultCatalog == "" {
+		return errors.New("default schema requires a default catalog")
+	}
+	err = s.validateUserMapping()
+	if err != nil {
+		return err
+	}
+	err = s.validateRoleRules()
+	if err != nil {
+		return err
+	}
+	switch s.BinaryEncoding {
+	case "":
+		s.BinaryEncoding = BinaryEncodingHex
+	case BinaryEncodingHex, BinaryEncodingBase64, BinaryEncodingUTF8:
+	default:
+		return fmt.Errorf("unknown binary encoding %q", s.BinaryEncoding)
+	}
+	err = validateTokenParams(s.TokenParams)
+	if err != nil {
+		return err
+	}
+	switch s.TokenAuthMethod {
+	case "":
+		s.TokenAuthMethod = TokenAuthClientSecretPost
+	case TokenAuthClientSecretPost, TokenAuthClientSecretBasic, TokenAuthPrivateKeyJWT:
+	default:
+		return fmt.Errorf("unknown token auth method %q", s.TokenAuthMethod)
+	}
+	switch s.TokenExchange {
+	case "":
+	case TokenExchangeClient, TokenExchangeForwarded:
+		if s.TokenUrl == "" && s.IssuerUrl == "" {
+			return errors.New("token exchange requires the OAuth token URL or issuer URL")
+		}
+	default:
+		return fmt.Errorf("unknown token exchange mode %q", s.TokenExchange)
+	}
+	if isReservedTokenParam(s.TokenExchangeUserParam) || isTokenExchangeParam(s.TokenExchangeUserParam) {
+		return fmt.Errorf("token exchange user parameter %q is already set by the token exchange", s.TokenExchangeUserParam)
+	}
+	if s.QueryTimeout < 0 {
+		return errors.New("query timeout must not be negative")
+	}
+	if s.MaxRows < 0 || s.MaxResultBytes < 0 || s.MaxRowsCeiling < 0 || s.MaxResultBytesCeiling < 0 {
+		return errors.New("result limits must not be negative")
+	}
 	if token, ok := config.DecryptedSecureJSONData["accessToken"]; ok {
 		s.AccessToken = token
 	}
 	if clientSecret, ok := config.DecryptedSecureJSONData["clientSecret"]; ok {
 		s.ClientSecret = clientSecret
 	}
+	if privateKey, ok := config.DecryptedSecureJSONData["clientPrivateKey"]; ok {
+		s.ClientPrivateKey = privateKey
+	}
+	return nil
+}
+
+func (s *TrinoDatasourceSettings) validateUserMapping() error {
+	switch s.UserMapping {
+	case "":
+		s.UserMapping = UserMappingLogin
+	case UserMappingLogin, UserMappingEmail, UserMappingEmailLocalPart:
+	case UserMappingRegex:
+		if s.UserMappingPattern == "" {
+			return errors.New("user mapping pattern is required for the regex user mapping")
+		}
+		if _, err := regexp.Compile(s.UserMappingPattern); err != nil {
+			return fmt.Errorf("invalid user mapping pattern: %w", err)
+		}
+	case UserMappingLookup:
+		if len(s.UserMappingTable) == 0 {
+			return errors.New("user mapping table is required for the lookup user mapping")
+		}
+	default:
+		return fmt.Errorf("unknown user mapping %q", s.UserMapping)
+	}
 	return nil
 }
 
-func parseHTTPURL(value string, name string) (*url.URL, error) {
+func (s *TrinoDatasourceSettings) validateRoleRules() error {
+	if _, err := ParseRoles(s.Roles); err != nil {
+		return err
+	}
+	for i, rule := range s.RoleRules {
+		switch {
+		case rule.OrgRole == "" && rule.Team == "":
+			return fmt.Errorf("role rule %d must have an org role or a team", i+1)
+		case rule.OrgRole != "" && rule.Team != "":
+			return fmt.Errorf("role rule %d must not have both an org role and a team", i+1)
+		case rule.OrgRole != "" && rule.OrgRole != "Viewer" && rule.OrgRole != "Editor" && rule.OrgRole != "Admin":
+			return fmt.Errorf("role rule %d has unknown org role %q", i+1, rule.OrgRole)
+		case rule.Team != "" && s.TeamsHeader == "":
+			return fmt.Errorf("role rule %d requires the teams header to be set", i+1)
+		}
+		roles, err := ParseRoles(rule.Roles)
+		if err != nil {
+			return fmt.Errorf("role rule %d: %w", i+1, err)
+		}
+		if len(roles) == 0 {
+			return fmt.Errorf("role rule %d must grant at least one role", i+1)
+		}
+	}
+	return nil
+}
+
+// reservedTokenParams are the parameters of the token request set from the
+// other OAuth settings.
+var reservedTokenParams = []string{
+	"grant_type", "client_id", "client_secret", "client_assertion", "client_assertion_type", "scope", "audience", "resource",
+}
+
+// tokenExchangeParams are the parameters of the token exchange request.
+var tokenExchangeParams = []string{
+	"requested_token_type", "subject_token", "subject_token_type",
+}
+
+func validateTokenParams(params map[string]string) error {
+	for name := range params {
+		if name == "" {
+			return errors.New("token parameter names must not be empty")
+		}
+		if isReservedTokenParam(name) {
+			return fmt.Errorf("token parameter %q must be set with the OAuth settings", name)
+		}
+	}
+	return nil
+}
+
+func isReservedTokenParam(name string) bool {
+	return containsFold(reservedTokenParams, name)
+}
+
+func isTokenExchangeParam(name string) bool {
+	return containsFold(tokenExchangeParams, name)
+}
+
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// sessionPropertyName matches system session properties such as
+// query_max_execution_time and catalog session properties such as
+// hive.parquet_use_column_names.
+var sessionPropertyName = regexp.MustCompile(`^([A-Za-z0-9_][A-Za-z0-9_-]*\.)?[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidateSessionProperties checks that session property names are valid
+// Trino property names and that the values can be sent to Trino.
+func ValidateSessionProperties(properties map[string]string) error {
+	for name, value := range properties {
+		if !sessionPropertyName.MatchString(name) {
+			return fmt.Errorf("invalid session property name %q", name)
+		}
+		if value == "" {
+			return fmt.Errorf("session property %q must have a value", name)
+		}
+		for i := 0; i < len(value); i++ {
+			// ';' separates the properties in the connection string.
+			if value[i] < '!' || value[i] > '~' || value[i] == ';' {
+				return fmt.Errorf("session property %q must be printable ASCII without spaces or ';'", name)
+			}
+		}
+	}
+	return nil
+}
+
+// ParseHTTPURL parses an HTTP(S) URL with a host, described by name in the
+// errors.
+func ParseHTTPURL(value string, name string) (*url.URL, error) {
 	parsedURL, err := url.Parse(value)
 	if err != nil {
 		return nil, fmt.Errorf("invalid %s: %w", name, err)
@@ -81,3 +378,25 @@ func parseHTTPURL(value string, name string) (*url.URL, error) {
 	}
 	return parsedURL, nil
 }
+
+// ParseRoles parses roles given as "catalog:role" pairs separated by ';', e.g.
+// "system:admin;hive:analyst".
+func ParseRoles(roleStr string) (map[string]string, error) {
+	roles := make(map[string]string)
+	if strings.TrimSpace(roleStr) == "" {
+		return roles, nil
+	}
+	pairs := strings.Split(roleStr, ";")
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid role format. expected catalog:role, got '%s'", pair)
+		}
+		catalog := strings.TrimSpace(parts[0])
+		role := strings.TrimSpace(parts[1])
+		if catalog != "" && role != "" {
+			roles[catalog] = role
+		}
+	}
+	return roles, nil
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"context"
+	"reflect"
 	"testing"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
@@ -83,6 +84,8 @@ func TestLoad_RejectsInvalidURLs(t *testing.T) {
 		{name: "Trino URL host", trinoURL: "https:///trino", jsonData: `{}`},
 		{name: "OAuth token URL scheme", trinoURL: "https://trino.example", jsonData: `{"tokenUrl":"file:///tmp/token"}`},
 		{name: "OAuth token URL host", trinoURL: "https://trino.example", jsonData: `{"tokenUrl":"https:///token"}`},
+		{name: "OAuth issuer URL scheme", trinoURL: "https://trino.example", jsonData: `{"issuerUrl":"ftp://idp.example"}`},
+		{name: "OAuth token and issuer URLs", trinoURL: "https://trino.example", jsonData: `{"tokenUrl":"https://idp.example/token","issuerUrl":"https://idp.example"}`},
 	}
 
 	for _, tt := range tests {
@@ -98,3 +101,327 @@ func TestLoad_RejectsInvalidURLs(t *testing.T) {
 		})
 	}
 }
+
+func TestLoad_SessionProperties(t *testing.T) {
+	tests := []struct {
+		name     string
+		jsonData string
+		wantErr  bool
+	}{
+		{name: "system property", jsonData: `{"sessionProperties": {"query_max_execution_time": "1h"}}`},
+		{name: "catalog property", jsonData: `{"sessionProperties": {"hive.parquet_use_column_names": "true"}}`},
+		{name: "catalog with hyphen", jsonData: `{"sessionProperties": {"my-hive.parquet_use_column_names": "true"}}`},
+		{name: "empty name", jsonData: `{"sessionProperties": {"": "true"}}`, wantErr: true},
+		{name: "name with spaces", jsonData: `{"sessionProperties": {"join distribution type": "BROADCAST"}}`, wantErr: true},
+		{name: "name with too many parts", jsonData: `{"sessionProperties": {"a.b.c": "true"}}`, wantErr: true},
+		{name: "header injection in name", jsonData: `{"sessionProperties": {"a=b,c": "true"}}`, wantErr: true},
+		{name: "empty value", jsonData: `{"sessionProperties": {"query_max_execution_time": ""}}`, wantErr: true},
+		{name: "value with separator", jsonData: `{"sessionProperties": {"query_max_execution_time": "1h;a:b"}}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := TrinoDatasourceSettings{}
+			err := settings.Load(context.Background(), backend.DataSourceInstanceSettings{
+				URL:      "http://localhost:8080",
+				JSONData: []byte(tt.jsonData),
+			})
+			if tt.wantErr && err == nil {
+				t.Fatal("expected an invalid session property error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestLoad_DefaultSchemaRequiresCatalog(t *testing.T) {
+	settings := TrinoDatasourceSettings{}
+	err := settings.Load(context.Background(), backend.DataSourceInstanceSettings{
+		URL:      "http://localhost:8080",
+		JSONData: []byte(`{"defaultSchema": "tiny"}`),
+	})
+	if err == nil {
+		t.Fatal("expected an error for a default schema without a default catalog")
+	}
+}
+
+func TestLoad_UserMapping(t *testing.T) {
+	tests := []struct {
+		name     string
+		jsonData string
+		wantErr  bool
+	}{
+		{name: "default", jsonData: `{}`},
+		{name: "email", jsonData: `{"userMapping": "email"}`},
+		{name: "regex", jsonData: `{"userMapping": "regex", "userMappingPattern": "^(.*)@example\\.com$", "userMappingReplacement": "$1"}`},
+		{name: "regex without pattern", jsonData: `{"userMapping": "regex"}`, wantErr: true},
+		{name: "invalid regex", jsonData: `{"userMapping": "regex", "userMappingPattern": "("}`, wantErr: true},
+		{name: "lookup", jsonData: `{"userMapping": "lookup", "userMappingTable": {"alice": "asmith"}}`},
+		{name: "lookup without table", jsonData: `{"userMapping": "lookup"}`, wantErr: true},
+		{name: "unknown mode", jsonData: `{"userMapping": "ldap"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := TrinoDatasourceSettings{}
+			err := settings.Load(context.Background(), backend.DataSourceInstanceSettings{
+				URL:      "http://localhost:8080",
+				JSONData: []byte(tt.jsonData),
+			})
+			if tt.wantErr && err == nil {
+				t.Fatal("expected an invalid user mapping error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseRoles(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "empty", input: "", want: map[string]string{}},
+		{name: "blank", input: "   ", want: map[string]string{}},
+		{
+			name:  "single",
+			input: "system:admin",
+			want:  map[string]string{"system": "admin"},
+		},
+		{
+			name:  "multiple",
+			input: "system:admin;catalog1:roleA;catalog2:roleB",
+			want:  map[string]string{"system": "admin", "catalog1": "roleA", "catalog2": "roleB"},
+		},
+		{
+			name:  "trims whitespace",
+			input: " system : admin ; catalog1 : roleA ",
+			want:  map[string]string{"system": "admin", "catalog1": "roleA"},
+		},
+		{
+			name:    "missing colon",
+			input:   "system-admin",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRoles(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad_RoleRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		jsonData string
+		wantErr  bool
+	}{
+		{name: "org role", jsonData: `{"roleRules": [{"orgRole": "Editor", "roles": "hive:writer"}]}`},
+		{name: "team", jsonData: `{"teamsHeader": "X-Grafana-Teams", "roleRules": [{"team": "analysts", "roles": "hive:reader"}]}`},
+		{name: "invalid data source roles", jsonData: `{"roles": "system-admin"}`, wantErr: true},
+		{name: "no org role or team", jsonData: `{"roleRules": [{"roles": "hive:writer"}]}`, wantErr: true},
+		{name: "org role and team", jsonData: `{"teamsHeader": "X-Grafana-Teams", "roleRules": [{"orgRole": "Editor", "team": "analysts", "roles": "hive:writer"}]}`, wantErr: true},
+		{name: "unknown org role", jsonData: `{"roleRules": [{"orgRole": "Owner", "roles": "hive:writer"}]}`, wantErr: true},
+		{name: "team without teams header", jsonData: `{"roleRules": [{"team": "analysts", "roles": "hive:reader"}]}`, wantErr: true},
+		{name: "invalid roles", jsonData: `{"roleRules": [{"orgRole": "Editor", "roles": "writer"}]}`, wantErr: true},
+		{name: "no roles", jsonData: `{"roleRules": [{"orgRole": "Editor", "roles": ""}]}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := TrinoDatasourceSettings{}
+			err := settings.Load(context.Background(), backend.DataSourceInstanceSettings{
+				URL:      "http://localhost:8080",
+				JSONData: []byte(tt.jsonData),
+			})
+			if tt.wantErr && err == nil {
+				t.Fatal("expected an invalid role rule error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestLoad_BinaryEncoding(t *testing.T) {
+	tests := []struct {
+		name     string
+		jsonData string
+		want     string
+		wantErr  bool
+	}{
+		{name: "default", jsonData: `{}`, want: BinaryEncodingHex},
+		{name: "base64", jsonData: `{"binaryEncoding": "base64"}`, want: BinaryEncodingBase64},
+		{name: "utf8", jsonData: `{"binaryEncoding": "utf8"}`, want: BinaryEncodingUTF8},
+		{name: "unknown encoding", jsonData: `{"binaryEncoding": "ascii85"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := TrinoDatasourceSettings{}
+			err := settings.Load(context.Background(), backend.DataSourceInstanceSettings{
+				URL:      "http://localhost:8080",
+				JSONData: []byte(tt.jsonData),
+			})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an unknown binary encoding error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if settings.BinaryEncoding != tt.want {
+				t.Errorf("got binary encoding %q, want %q", settings.BinaryEncoding, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad_QueryTimeout(t *testing.T) {
+	settings := TrinoDatasourceSettings{}
+	err := settings.Load(context.Background(), backend.DataSourceInstanceSettings{
+		URL:      "http://localhost:8080",
+		JSONData: []byte(`{"queryTimeout": 60}`),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if settings.QueryTimeout != 60 {
+		t.Errorf("got query timeout %d, want 60", settings.QueryTimeout)
+	}
+
+	err = settings.Load(context.Background(), backend.DataSourceInstanceSettings{
+		URL:      "http://localhost:8080",
+		JSONData: []byte(`{"queryTimeout": -1}`),
+	})
+	if err == nil {
+		t.Error("expected a negative query timeout error")
+	}
+}
+
+func TestLoad_RejectsNegativeResultLimits(t *testing.T) {
+	settings := TrinoDatasourceSettings{}
+	err := settings.Load(context.Background(), backend.DataSourceInstanceSettings{
+		URL:      "http://localhost:8080",
+		JSONData: []byte(`{"maxRows": 1000, "maxResultBytesCeiling": -1}`),
+	})
+	if err == nil {
+		t.Error("expected a negative result limit error")
+	}
+}
+
+func TestLoad_TokenParams(t *testing.T) {
+	tests := []struct {
+		name     string
+		jsonData string
+		wantErr  bool
+	}{
+		{name: "extra parameters", jsonData: `{"scopes": "openid trino", "audience": "trino", "tokenParams": {"tenant": "analytics"}}`},
+		{name: "reserved parameter", jsonData: `{"tokenParams": {"client_id": "other"}}`, wantErr: true},
+		{name: "dedicated setting", jsonData: `{"tokenParams": {"Scope": "openid"}}`, wantErr: true},
+		{name: "empty name", jsonData: `{"tokenParams": {"": "value"}}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := TrinoDatasourceSettings{}
+			err := settings.Load(context.Background(), backend.DataSourceInstanceSettings{
+				URL:      "http://localhost:8080",
+				JSONData: []byte(tt.jsonData),
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad_TokenAuthMethod(t *testing.T) {
+	tests := []struct {
+		name     string
+		jsonData string
+		want     string
+		wantErr  bool
+	}{
+		{name: "default", jsonData: `{}`, want: TokenAuthClientSecretPost},
+		{name: "client_secret_basic", jsonData: `{"tokenAuthMethod": "client_secret_basic"}`, want: TokenAuthClientSecretBasic},
+		{name: "private_key_jwt", jsonData: `{"tokenAuthMethod": "private_key_jwt", "clientKeyId": "key-1"}`, want: TokenAuthPrivateKeyJWT},
+		{name: "unknown method", jsonData: `{"tokenAuthMethod": "tls_client_auth"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := TrinoDatasourceSettings{}
+			err := settings.Load(context.Background(), backend.DataSourceInstanceSettings{
+				URL:                     "http://localhost:8080",
+				JSONData:                []byte(tt.jsonData),
+				DecryptedSecureJSONData: map[string]string{"clientPrivateKey": "key"},
+			})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an unknown token auth method error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if settings.TokenAuthMethod != tt.want {
+				t.Errorf("got token auth method %q, want %q", settings.TokenAuthMethod, tt.want)
+			}
+			if settings.ClientPrivateKey != "key" {
+				t.Errorf("got client private key %q, want the secure JSON data", settings.ClientPrivateKey)
+			}
+		})
+	}
+}
+
+func TestLoad_TokenExchange(t *testing.T) {
+	tests := []struct {
+		name     string
+		jsonData string
+		wantErr  bool
+	}{
+		{name: "disabled", jsonData: `{}`},
+		{name: "client token", jsonData: `{"tokenExchange": "client", "tokenUrl": "https://idp.example/token"}`},
+		{name: "forwarded token", jsonData: `{"tokenExchange": "forwarded", "issuerUrl": "https://idp.example"}`},
+		{name: "without OAuth", jsonData: `{"tokenExchange": "client"}`, wantErr: true},
+		{name: "unknown mode", jsonData: `{"tokenExchange": "impersonate", "tokenUrl": "https://idp.example/token"}`, wantErr: true},
+		{name: "user parameter", jsonData: `{"tokenExchange": "client", "tokenUrl": "https://idp.example/token", "tokenExchangeUserParam": "sub"}`},
+		{name: "reserved user parameter", jsonData: `{"tokenExchange": "client", "tokenUrl": "https://idp.example/token", "tokenExchangeUserParam": "subject_token"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := TrinoDatasourceSettings{}
+			err := settings.Load(context.Background(), backend.DataSourceInstanceSettings{
+				URL:      "http://localhost:8080",
+				JSONData: []byte(tt.jsonData),
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
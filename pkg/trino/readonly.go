@@ -0,0 +1,151 @@
+package trino
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// readOnlyStatements are the statements allowed in read-only mode.
+var readOnlyStatements = map[string]bool{
+	"SELECT":   true,
+	"WITH":     true,
+	"SHOW":     true,
+	"DESCRIBE": true,
+	"EXPLAIN":  true,
+	"VALUES":   true,
+}
+
+// checkReadOnly returns an error unless sql is a single read-only statement.
+// Comments, string literals and quoted identifiers are skipped, so that
+// neither hide a statement nor make one up.
+func checkReadOnly(sql string) error {
+	tokens, err := tokenize(sql)
+	if err != nil {
+		return err
+	}
+
+	var statement []string
+	for i, token := range tokens {
+		if token != ";" {
+			continue
+		}
+		for _, rest := range tokens[i+1:] {
+			if rest != ";" {
+				return errors.New("multiple statements are not allowed in read-only mode")
+			}
+		}
+		statement = tokens[:i]
+		break
+	}
+	if statement == nil {
+		statement = tokens
+	}
+
+	return checkReadOnlyStatement(statement)
+}
+
+func checkReadOnlyStatement(tokens []string) error {
+	for len(tokens) > 0 && tokens[0] == "(" {
+		tokens = tokens[1:]
+	}
+	if len(tokens) == 0 {
+		return errors.New("empty statement")
+	}
+
+	keyword := strings.ToUpper(tokens[0])
+	if !readOnlyStatements[keyword] {
+		return fmt.Errorf("only SELECT, WITH, SHOW, DESCRIBE, EXPLAIN and VALUES statements are allowed in read-only mode, got %s", keyword)
+	}
+	if keyword != "EXPLAIN" {
+		return nil
+	}
+
+	// EXPLAIN ANALYZE runs the explained statement, so it must be read-only
+	// as well: EXPLAIN [ ( option [, ...] ) ] statement or
+	// EXPLAIN ANALYZE [ VERBOSE ] statement.
+	tokens = tokens[1:]
+	if len(tokens) > 0 && strings.EqualFold(tokens[0], "ANALYZE") {
+		tokens = tokens[1:]
+		if len(tokens) > 0 && strings.EqualFold(tokens[0], "VERBOSE") {
+			tokens = tokens[1:]
+		}
+	} else if len(tokens) > 1 && tokens[0] == "(" && (strings.EqualFold(tokens[1], "TYPE") || strings.EqualFold(tokens[1], "FORMAT")) {
+		end := 0
+		for end < len(tokens) && tokens[end] != ")" {
+			end++
+		}
+		if end == len(tokens) {
+			return errors.New("unterminated EXPLAIN options")
+		}
+		tokens = tokens[end+1:]
+	}
+	return checkReadOnlyStatement(tokens)
+}
+
+// tokenize splits sql into words and punctuation. Literals and quoted
+// identifiers become a single token and comments are dropped.
+func tokenize(sql string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+		case strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				return tokens, nil
+			}
+			i += end + 1
+		case strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return nil, errors.New("unterminated comment")
+			}
+			i += end + 4
+		case c == '\'' || c == '"':
+			end, err := quoteEnd(sql, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, sql[i:end])
+			i = end
+		case isWordByte(c):
+			end := i + 1
+			for end < len(sql) && isWordByte(sql[end]) {
+				end++
+			}
+			tokens = append(tokens, sql[i:end])
+			i = end
+		default:
+			tokens = append(tokens, sql[i:i+1])
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+// quoteEnd returns the index after the literal or quoted identifier starting
+// at start, where doubled quotes are escaped quotes.
+func quoteEnd(sql string, start int) (int, error) {
+	quote := sql[start]
+	for i := start + 1; i < len(sql); i++ {
+		if sql[i] != quote {
+			continue
+		}
+		if i+1 < len(sql) && sql[i+1] == quote {
+			i++
+			continue
+		}
+		return i + 1, nil
+	}
+	if quote == '"' {
+		return 0, errors.New("unterminated quoted identifier")
+	}
+	return 0, errors.New("unterminated string literal")
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
@@ -0,0 +1,61 @@
+package trino
+
+import (
+	"testing"
+)
+
+func TestCheckReadOnly(t *testing.T) {
+	tests := []struct {
+		name    string
+		sql     string
+		wantErr bool
+	}{
+		{name: "select", sql: "SELECT * FROM tpch.tiny.orders"},
+		{name: "lower case", sql: "select 1"},
+		{name: "with", sql: "WITH t AS (SELECT 1 AS a) SELECT a FROM t"},
+		{name: "show", sql: "SHOW CATALOGS"},
+		{name: "describe", sql: "DESCRIBE tpch.tiny.orders"},
+		{name: "values", sql: "VALUES 1, 2, 3"},
+		{name: "parenthesized", sql: "(SELECT 1) UNION (SELECT 2)"},
+		{name: "trailing semicolon", sql: "SELECT 1;  "},
+		{name: "leading comment", sql: "-- orders per day\nSELECT 1"},
+		{name: "block comment", sql: "/* DROP TABLE orders */ SELECT 1"},
+		{name: "semicolon in string", sql: "SELECT 'a; DROP TABLE orders'"},
+		{name: "escaped quote in string", sql: "SELECT 'it''s; DROP TABLE orders'"},
+		{name: "semicolon in quoted identifier", sql: `SELECT "a;b" FROM t`},
+		{name: "trailing line comment", sql: "SELECT 1 -- ; DROP TABLE orders"},
+		{name: "explain", sql: "EXPLAIN SELECT 1"},
+		{name: "explain with options", sql: "EXPLAIN (TYPE DISTRIBUTED, FORMAT JSON) SELECT 1"},
+		{name: "explain analyze", sql: "EXPLAIN ANALYZE VERBOSE SELECT 1"},
+
+		{name: "empty", sql: "", wantErr: true},
+		{name: "only comments", sql: "-- SELECT 1", wantErr: true},
+		{name: "drop", sql: "DROP TABLE orders", wantErr: true},
+		{name: "insert", sql: "INSERT INTO orders VALUES (1)", wantErr: true},
+		{name: "create table as select", sql: "CREATE TABLE t AS SELECT 1", wantErr: true},
+		{name: "call", sql: "CALL system.sync_partition_metadata('web', 'page_views', 'FULL')", wantErr: true},
+		{name: "execute immediate", sql: "EXECUTE IMMEDIATE 'DROP TABLE orders'", wantErr: true},
+		{name: "set session", sql: "SET SESSION query_max_run_time = '1s'", wantErr: true},
+		{name: "multiple statements", sql: "SELECT 1; DROP TABLE orders", wantErr: true},
+		{name: "multiple statements after comment", sql: "SELECT 1; -- comment\nDELETE FROM orders", wantErr: true},
+		{name: "statement hidden behind block comment", sql: "/* SELECT */ DELETE FROM orders", wantErr: true},
+		{name: "statement hidden behind line comment", sql: "-- SELECT\nDELETE FROM orders", wantErr: true},
+		{name: "comment inside keyword position", sql: "DELETE/**/FROM orders", wantErr: true},
+		{name: "explain analyze insert", sql: "EXPLAIN ANALYZE INSERT INTO orders VALUES (1)", wantErr: true},
+		{name: "explain with options and insert", sql: "EXPLAIN (TYPE IO) INSERT INTO orders VALUES (1)", wantErr: true},
+		{name: "unterminated string", sql: "SELECT 'a; DROP TABLE orders", wantErr: true},
+		{name: "unterminated comment", sql: "SELECT 1 /* ; DROP TABLE orders", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkReadOnly(tt.sql)
+			if tt.wantErr && err == nil {
+				t.Fatalf("expected %q to be rejected", tt.sql)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("expected %q to be allowed, got: %v", tt.sql, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package trino
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
+)
+
+// timestampLayout parses Trino timestamps of any precision: Go keeps the
+// first nine fraction digits, so timestamp(10) to timestamp(12) values are
+// truncated to nanoseconds.
+const timestampLayout = "2006-01-02 15:04:05.999999999"
+
+// timestampConverter converts the values of a date or timestamp type to UTC
+// times. The driver reads them as text, which is parsed by parseTimestamp, so
+// that the wall clock of values without a time zone is read as UTC whatever
+// the local time zone of the plugin process, while values with a time zone
+// are converted to UTC.
+func timestampConverter(typeName string) sqlutil.Converter {
+	return sqlutil.Converter{
+		Name:          "trino " + strings.ToLower(typeName),
+		InputScanType: reflect.TypeOf(sql.NullString{}),
+		InputTypeName: typeName,
+		FrameConverter: sqlutil.FrameConverter{
+			FieldType: data.FieldTypeNullableTime,
+			ConverterFunc: func(in interface{}) (interface{}, error) {
+				v := in.(*sql.NullString)
+				if !v.Valid {
+					return (*time.Time)(nil), nil
+				}
+				t, err := parseTimestamp(v.String)
+				if err != nil {
+					return nil, err
+				}
+				return &t, nil
+			},
+		},
+	}
+}
+
+// parseTimestamp parses the textual representation of a Trino date or
+// timestamp, with or without a time zone, e.g. "2024-03-01 12:30:00.123456789012"
+// or "2024-03-01 12:30:00.123 Europe/Warsaw", to a UTC time. Values without
+// a time zone are read as UTC.
+func parseTimestamp(value string) (time.Time, error) {
+	parts := strings.Split(value, " ")
+	if len(parts) > 3 {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q", value)
+	}
+	if len(parts) == 1 {
+		return time.ParseInLocation(time.DateOnly, value, time.UTC)
+	}
+
+	location := time.UTC
+	if len(parts) == 3 {
+		zone, err := parseTimeZone(parts[2])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid timestamp %q: %w", value, err)
+		}
+		location = zone
+	}
+
+	t, err := time.ParseInLocation(timestampLayout, parts[0]+" "+parts[1], location)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.UTC(), nil
+}
+
+// parseTimeZone parses a Trino time zone: an offset like +05:30 or a zone name.
+func parseTimeZone(zone string) (*time.Location, error) {
+	if !strings.HasPrefix(zone, "+") && !strings.HasPrefix(zone, "-") {
+		return time.LoadLocation(zone)
+	}
+	offset, err := time.Parse("-07:00", zone)
+	if err != nil {
+		return nil, err
+	}
+	_, seconds := offset.Zone()
+	return time.FixedZone(zone, seconds), nil
+}
@@ -0,0 +1,110 @@
+package trino
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const fraction = "123456789012"
+
+// timestampWithPrecision returns 2024-03-01 12:30:45 with the first
+// precision digits of fraction, and the time it stands for in UTC when the
+// offset is applied.
+func timestampWithPrecision(precision int, offset time.Duration) (string, time.Time) {
+	value := "2024-03-01 12:30:45"
+	nanos := 0
+	if precision > 0 {
+		value += "." + fraction[:precision]
+		digits := fraction[:min(precision, 9)] + strings.Repeat("0", 9-min(precision, 9))
+		_, _ = fmt.Sscan(digits, &nanos)
+	}
+	return value, time.Date(2024, 3, 1, 12, 30, 45, nanos, time.UTC).Add(-offset)
+}
+
+func TestParseTimestamp(t *testing.T) {
+	for precision := 0; precision <= 12; precision++ {
+		value, want := timestampWithPrecision(precision, 0)
+		_, wantOffset := timestampWithPrecision(precision, 5*time.Hour+30*time.Minute)
+		_, wantWarsaw := timestampWithPrecision(precision, time.Hour)
+
+		tests := []struct {
+			value string
+			want  time.Time
+		}{
+			{value: value, want: want},
+			{value: value + " UTC", want: want},
+			{value: value + " +05:30", want: wantOffset},
+			{value: value + " Europe/Warsaw", want: wantWarsaw},
+		}
+		for _, tt := range tests {
+			t.Run(tt.value, func(t *testing.T) {
+				got, err := parseTimestamp(tt.value)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !got.Equal(tt.want) || got.Location() != time.UTC {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+			})
+		}
+	}
+
+	t.Run("date", func(t *testing.T) {
+		got, err := parseTimestamp("2024-03-01")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if want := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	for _, invalid := range []string{"2024-03-01 12:30", "2024-03-01 12:30:45 Nowhere/Nothing", "a b c d"} {
+		if _, err := parseTimestamp(invalid); err == nil {
+			t.Errorf("expected an error parsing %q", invalid)
+		}
+	}
+}
+
+func TestConverters_Timestamps(t *testing.T) {
+	result := fakeResult{rows: [][]interface{}{{}, {}}}
+	var want []time.Time
+	for precision := 0; precision <= 12; precision++ {
+		value, utc := timestampWithPrecision(precision, 0)
+		_, offset := timestampWithPrecision(precision, -2*time.Hour)
+		result.columns = append(result.columns, fmt.Sprintf("ts%d", precision), fmt.Sprintf("tstz%d", precision))
+		result.types = append(result.types, fmt.Sprintf("timestamp(%d)", precision), fmt.Sprintf("timestamp(%d) with time zone", precision))
+		result.rows[0] = append(result.rows[0], value, value+" -02:00")
+		result.rows[1] = append(result.rows[1], nil, nil)
+		want = append(want, utc, offset)
+	}
+	// Wall clocks skipped and repeated by daylight saving time transitions
+	// are kept, whatever the local time zone.
+	for i, value := range []string{"2024-03-31 02:30:00", "2024-10-27 02:30:00"} {
+		result.columns = append(result.columns, fmt.Sprintf("dst%d", i))
+		result.types = append(result.types, "timestamp(0)")
+		result.rows[0] = append(result.rows[0], value)
+		result.rows[1] = append(result.rows[1], nil)
+		wall, _ := time.Parse(time.DateTime, value)
+		want = append(want, wall)
+	}
+	frame := convertResult(t, `{}`, result)
+
+	for i, field := range frame.Fields {
+		if field.Type() != data.FieldTypeNullableTime {
+			t.Errorf("%s: got field type %s, want %s", field.Name, field.Type(), data.FieldTypeNullableTime)
+			continue
+		}
+		got := field.At(0).(*time.Time)
+		if got == nil || !got.Equal(want[i]) || got.Location() != time.UTC {
+			t.Errorf("%s: got %v, want %v", field.Name, got, want[i])
+		}
+		if got := field.At(1).(*time.Time); got != nil {
+			t.Errorf("%s: got %v, want NULL", field.Name, got)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package trino
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	// maxCachedTokens bounds the number of forwarded tokens kept in memory.
+	maxCachedTokens = 1000
+	// defaultTokenLifetime is how long tokens without an expiration, like
+	// opaque tokens, are cached.
+	defaultTokenLifetime = 5 * time.Minute
+	// tokenExpiryMargin is how long before their expiration cached tokens
+	// are no longer used, so that they don't expire during a query.
+	tokenExpiryMargin = 30 * time.Second
+)
+
+var tokenCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "grafana_plugin",
+	Name:      "trino_forwarded_token_cache_lookups_total",
+	Help:      "Lookups of cached forwarded OAuth tokens of requests without one, by result (hit or miss).",
+}, []string{"result"})
+
+// forwardedTokens caches the OAuth tokens forwarded by Grafana for each data
+// source and user, for the requests without one, like alert evaluations and
+// background refreshes.
+var forwardedTokens = newTokenCache(maxCachedTokens)
+
+type tokenCacheKey struct {
+	datasourceUID string
+	user          string
+}
+
+type cachedToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+// tokenCache is a bounded cache of tokens, which drops the tokens as they
+// expire.
+type tokenCache struct {
+	lock    sync.Mutex
+	size    int
+	tokens  map[tokenCacheKey]cachedToken
+	now     func() time.Time
+	lookups *prometheus.CounterVec
+}
+
+func newTokenCache(size int) *tokenCache {
+	return &tokenCache{
+		size:    size,
+		tokens:  map[tokenCacheKey]cachedToken{},
+		now:     time.Now,
+		lookups: tokenCacheLookups,
+	}
+}
+
+// forwardedToken returns the forwarded Authorization header of the request,
+// caching its token for the user, or else the header with the cached token
+// of the user.
+func (c *tokenCache) forwardedToken(pluginContext backend.PluginContext, header string) string {
+	if pluginContext.User == nil || pluginContext.User.Login == "" || pluginContext.DataSourceInstanceSettings == nil {
+		return header
+	}
+	key := tokenCacheKey{datasourceUID: pluginContext.DataSourceInstanceSettings.UID, user: pluginContext.User.Login}
+	if token, ok := strings.CutPrefix(header, bearerPrefix); ok {
+		c.put(key, token)
+		return header
+	}
+	if header != "" {
+		return header
+	}
+	if token, ok := c.get(key); ok {
+		return bearerPrefix + token
+	}
+	return header
+}
+
+func (c *tokenCache) get(key tokenCacheKey) (string, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	cached, ok := c.tokens[key]
+	if ok && !c.now().Add(tokenExpiryMargin).Before(cached.expiresAt) {
+		delete(c.tokens, key)
+		ok = false
+	}
+	if !ok {
+		c.lookups.WithLabelValues("miss").Inc()
+		return "", false
+	}
+	c.lookups.WithLabelValues("hit").Inc()
+	return cached.token, true
+}
+
+func (c *tokenCache) put(key tokenCacheKey, token string) {
+	now := c.now()
+	expiresAt, ok := tokenExpiration(token)
+	if !ok {
+		expiresAt = now.Add(defaultTokenLifetime)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !now.Add(tokenExpiryMargin).Before(expiresAt) {
+		delete(c.tokens, key)
+		return
+	}
+	if _, ok := c.tokens[key]; !ok && len(c.tokens) >= c.size {
+		c.evict(now)
+	}
+	c.tokens[key] = cachedToken{token: token, expiresAt: expiresAt}
+}
+
+// evict drops the expired tokens, or else the token expiring first. The lock
+// must be held.
+func (c *tokenCache) evict(now time.Time) {
+	var first tokenCacheKey
+	var firstExpiresAt time.Time
+	for key, cached := range c.tokens {
+		if !now.Add(tokenExpiryMargin).Before(cached.expiresAt) {
+			delete(c.tokens, key)
+			continue
+		}
+		if firstExpiresAt.IsZero() || cached.expiresAt.Before(firstExpiresAt) {
+			first, firstExpiresAt = key, cached.expiresAt
+		}
+	}
+	if len(c.tokens) >= c.size {
+		delete(c.tokens, first)
+	}
+}
+
+// tokenExpiration returns the expiration of a JWT, from its "exp" claim. The
+// token isn't verified, as Trino verifies it.
+func tokenExpiration(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp *json.Number `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == nil {
+		return time.Time{}, false
+	}
+	exp, err := claims.Exp.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(exp), 0), true
+}
@@ -0,0 +1,138 @@
+package trino
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// testJWT returns an unsigned JWT expiring at exp.
+func testJWT(subject string, exp time.Time) string {
+	payload := fmt.Sprintf(`{"sub":%q,"exp":%d}`, subject, exp.Unix())
+	return "eyJhbGciOiJub25lIn0." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".sig"
+}
+
+func newTestTokenCache(size int, now *time.Time) *tokenCache {
+	c := newTokenCache(size)
+	c.now = func() time.Time { return *now }
+	c.lookups = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "lookups"}, []string{"result"})
+	return c
+}
+
+func userPluginContext(datasourceUID, login string) backend.PluginContext {
+	return backend.PluginContext{
+		User:                       &backend.User{Login: login},
+		DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{UID: datasourceUID},
+	}
+}
+
+func TestTokenCache_ForwardedToken(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	c := newTestTokenCache(10, &now)
+	aliceToken := testJWT("alice", now.Add(time.Hour))
+
+	if got := c.forwardedToken(userPluginContext("ds", "alice"), ""); got != "" {
+		t.Errorf("got %q before any token was forwarded, want none", got)
+	}
+	if got := c.forwardedToken(userPluginContext("ds", "alice"), "Bearer "+aliceToken); got != "Bearer "+aliceToken {
+		t.Errorf("got %q, want the forwarded header", got)
+	}
+	if got := c.forwardedToken(userPluginContext("ds", "alice"), ""); got != "Bearer "+aliceToken {
+		t.Errorf("got %q, want the cached token", got)
+	}
+	if got := c.forwardedToken(userPluginContext("other-ds", "alice"), ""); got != "" {
+		t.Errorf("got %q for another data source, want none", got)
+	}
+	if got := c.forwardedToken(userPluginContext("ds", "bob"), ""); got != "" {
+		t.Errorf("got %q for another user, want none", got)
+	}
+	if got := c.forwardedToken(backend.PluginContext{DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{UID: "ds"}}, ""); got != "" {
+		t.Errorf("got %q without a user, want none", got)
+	}
+
+	if hits := testutil.ToFloat64(c.lookups.WithLabelValues("hit")); hits != 1 {
+		t.Errorf("got %v hits, want 1", hits)
+	}
+	if misses := testutil.ToFloat64(c.lookups.WithLabelValues("miss")); misses != 3 {
+		t.Errorf("got %v misses, want 3", misses)
+	}
+}
+
+func TestTokenCache_Expiration(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	c := newTestTokenCache(10, &now)
+	key := tokenCacheKey{datasourceUID: "ds", user: "alice"}
+
+	c.put(key, testJWT("alice", now.Add(time.Hour)))
+	now = now.Add(time.Hour - tokenExpiryMargin)
+	if _, ok := c.get(key); ok {
+		t.Error("expected the token about to expire not to be used")
+	}
+
+	c.put(key, testJWT("alice", now.Add(-time.Minute)))
+	if _, ok := c.get(key); ok {
+		t.Error("expected an expired token not to be cached")
+	}
+
+	c.put(key, "opaque-token")
+	now = now.Add(defaultTokenLifetime - tokenExpiryMargin - time.Second)
+	if token, ok := c.get(key); !ok || token != "opaque-token" {
+		t.Errorf("got %q, %v, want the opaque token within its default lifetime", token, ok)
+	}
+	now = now.Add(time.Second)
+	if _, ok := c.get(key); ok {
+		t.Error("expected the opaque token to expire after its default lifetime")
+	}
+}
+
+func TestTokenCache_IsBounded(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	c := newTestTokenCache(2, &now)
+	alice := tokenCacheKey{datasourceUID: "ds", user: "alice"}
+	bob := tokenCacheKey{datasourceUID: "ds", user: "bob"}
+	carol := tokenCacheKey{datasourceUID: "ds", user: "carol"}
+
+	c.put(alice, testJWT("alice", now.Add(2*time.Hour)))
+	c.put(bob, testJWT("bob", now.Add(time.Hour)))
+	c.put(carol, testJWT("carol", now.Add(3*time.Hour)))
+
+	if len(c.tokens) != 2 {
+		t.Fatalf("got %d cached tokens, want 2", len(c.tokens))
+	}
+	if _, ok := c.get(bob); ok {
+		t.Error("expected the token expiring first to be evicted")
+	}
+	for _, key := range []tokenCacheKey{alice, carol} {
+		if _, ok := c.get(key); !ok {
+			t.Errorf("expected the token of %s to be cached", key.user)
+		}
+	}
+}
+
+func TestTokenExpiration(t *testing.T) {
+	exp := time.Unix(1700003600, 0)
+	tests := []struct {
+		name   string
+		token  string
+		want   time.Time
+		wantOK bool
+	}{
+		{name: "JWT", token: testJWT("alice", exp), want: exp, wantOK: true},
+		{name: "JWT without exp", token: "eyJhbGciOiJub25lIn0." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"alice"}`)) + ".sig"},
+		{name: "opaque token", token: "opaque-token"},
+		{name: "invalid payload", token: "a.b.c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tokenExpiration(tt.token)
+			if ok != tt.wantOK || !got.Equal(tt.want) {
+				t.Errorf("tokenExpiration() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
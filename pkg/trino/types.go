@@ -0,0 +1,151 @@
+package trino
+
+import (
+	"strings"
+)
+
+// trinoType is a parsed Trino type name as reported by the driver, e.g.
+// DECIMAL, TIMESTAMP(3) WITH TIME ZONE or ROW(X INTEGER, Y ARRAY(VARCHAR)).
+type trinoType struct {
+	// name is the lower case type name without its parameters, e.g.
+	// "row" or "timestamp with time zone".
+	name   string
+	params []trinoTypeParam
+}
+
+// trinoTypeParam is a type parameter: either a type, with its field name for
+// row types, or a literal such as the precision of a decimal type.
+type trinoTypeParam struct {
+	field   string
+	typ     *trinoType
+	literal string
+}
+
+// parseTrinoType parses a type name. Unquoted row field names are lower
+// cased, as the driver reports type names in upper case.
+func parseTrinoType(typeName string) trinoType {
+	typeName = strings.TrimSpace(typeName)
+	open := strings.IndexByte(typeName, '(')
+	if open < 0 {
+		return trinoType{name: strings.ToLower(typeName)}
+	}
+	end := closingParen(typeName, open)
+	t := trinoType{name: strings.ToLower(strings.TrimSpace(typeName[:open] + typeName[end+1:]))}
+	for _, param := range splitParams(typeName[open+1 : end]) {
+		t.params = append(t.params, parseTypeParam(t.name, param))
+	}
+	return t
+}
+
+func parseTypeParam(typeName, param string) trinoTypeParam {
+	if param != "" && strings.Trim(param, "0123456789") == "" {
+		return trinoTypeParam{literal: param}
+	}
+	if typeName != "row" {
+		paramType := parseTrinoType(param)
+		return trinoTypeParam{typ: &paramType}
+	}
+
+	field, fieldType := splitRowField(param)
+	paramType := parseTrinoType(fieldType)
+	return trinoTypeParam{field: field, typ: &paramType}
+}
+
+// splitRowField splits a row field into its name, which is empty for
+// anonymous fields, and its type.
+func splitRowField(param string) (string, string) {
+	if strings.HasPrefix(param, `"`) {
+		end, err := quoteEnd(param, 0)
+		if err == nil {
+			name := strings.ReplaceAll(param[1:end-1], `""`, `"`)
+			return name, strings.TrimSpace(param[end:])
+		}
+	}
+
+	space := strings.IndexByte(param, ' ')
+	if space < 0 || strings.ContainsRune(param[:space], '(') {
+		return "", param
+	}
+	// The remaining words of types like TIME WITH TIME ZONE or INTERVAL DAY
+	// TO SECOND aren't a type.
+	rest := strings.ToUpper(param[space+1:])
+	for _, prefix := range []string{"WITH ", "WITHOUT ", "DAY TO ", "YEAR TO "} {
+		if strings.HasPrefix(rest, prefix) {
+			return "", param
+		}
+	}
+	return strings.ToLower(param[:space]), strings.TrimSpace(param[space+1:])
+}
+
+// closingParen returns the index of the parenthesis closing the one at open,
+// or the end of s if it isn't closed.
+func closingParen(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			end, err := quoteEnd(s, i)
+			if err != nil {
+				return len(s) - 1
+			}
+			i = end - 1
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(s) - 1
+}
+
+// splitParams splits type parameters at the commas outside of nested
+// parameters and quoted field names.
+func splitParams(s string) []string {
+	var params []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			end, err := quoteEnd(s, i)
+			if err != nil {
+				i = len(s) - 1
+				continue
+			}
+			i = end - 1
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				params = append(params, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(params, strings.TrimSpace(s[start:]))
+}
+
+// param returns the type of the i-th parameter, or an unknown type.
+func (t trinoType) param(i int) trinoType {
+	if i < len(t.params) && t.params[i].typ != nil {
+		return *t.params[i].typ
+	}
+	return trinoType{name: "unknown"}
+}
+
+// namedFields reports whether t is a row type with named fields.
+func (t trinoType) namedFields() bool {
+	if t.name != "row" || len(t.params) == 0 {
+		return false
+	}
+	for _, param := range t.params {
+		if param.field == "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+package trino
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTrinoType(t *testing.T) {
+	integer := trinoType{name: "integer"}
+	varchar := trinoType{name: "varchar"}
+
+	tests := []struct {
+		typeName string
+		want     trinoType
+	}{
+		{typeName: "BIGINT", want: trinoType{name: "bigint"}},
+		{typeName: "TIMESTAMP WITH TIME ZONE", want: trinoType{name: "timestamp with time zone"}},
+		{
+			typeName: "TIMESTAMP(3) WITH TIME ZONE",
+			want:     trinoType{name: "timestamp with time zone", params: []trinoTypeParam{{literal: "3"}}},
+		},
+		{
+			typeName: "DECIMAL(12, 2)",
+			want:     trinoType{name: "decimal", params: []trinoTypeParam{{literal: "12"}, {literal: "2"}}},
+		},
+		{
+			typeName: "MAP(VARCHAR, ARRAY(INTEGER))",
+			want: trinoType{name: "map", params: []trinoTypeParam{
+				{typ: &varchar},
+				{typ: &trinoType{name: "array", params: []trinoTypeParam{{typ: &integer}}}},
+			}},
+		},
+		{
+			typeName: `ROW(X INTEGER, "Y, Z" VARCHAR, TIME TIME(3) WITH TIME ZONE)`,
+			want: trinoType{name: "row", params: []trinoTypeParam{
+				{field: "x", typ: &integer},
+				{field: "Y, Z", typ: &varchar},
+				{field: "time", typ: &trinoType{name: "time with time zone", params: []trinoTypeParam{{literal: "3"}}}},
+			}},
+		},
+		{
+			typeName: "ROW(INTEGER, INTERVAL DAY TO SECOND)",
+			want: trinoType{name: "row", params: []trinoTypeParam{
+				{typ: &integer},
+				{typ: &trinoType{name: "interval day to second"}},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.typeName, func(t *testing.T) {
+			if got := parseTrinoType(tt.typeName); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
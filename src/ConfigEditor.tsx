@@ -1,7 +1,30 @@
 import React, { ChangeEvent } from 'react';
-import { DataSourceHttpSettings, InlineField, InlineSwitch, SecretInput, Input } from '@grafana/ui';
-import { DataSourcePluginOptionsEditorProps } from '@grafana/data';
-import { TrinoDataSourceOptions, TrinoSecureJsonData } from './types';
+import {
+  DataSourceHttpSettings,
+  InlineField,
+  InlineSwitch,
+  SecretInput,
+  SecretTextArea,
+  Input,
+  Select,
+} from '@grafana/ui';
+import { DataSourcePluginOptionsEditorProps, SelectableValue } from '@grafana/data';
+import {
+  BinaryEncoding,
+  SelectableBinaryEncodings,
+  SelectableTokenAuthMethods,
+  SelectableTokenExchanges,
+  SelectableUserMappings,
+  TokenAuthMethod,
+  TokenExchange,
+  TrinoDataSourceOptions,
+  TrinoSecureJsonData,
+  RoleRule,
+  UserMapping,
+  validateSessionProperty,
+} from './types';
+import { KeyValueEditor } from './KeyValueEditor';
+import { RoleRulesEditor } from './RoleRulesEditor';
 
 interface Props extends DataSourcePluginOptionsEditorProps<TrinoDataSourceOptions, TrinoSecureJsonData> {}
 
@@ -11,6 +34,39 @@ export function ConfigEditor(props: Props) {
   const onEnableImpersonationChange = (event: ChangeEvent<HTMLInputElement>) => {
     onOptionsChange({ ...options, jsonData: { ...options.jsonData, enableImpersonation: event.target.checked } });
   };
+  const onReadOnlyChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...options.jsonData, readOnly: event.target.checked } });
+  };
+  const onFlattenRowsChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...options.jsonData, flattenRows: event.target.checked } });
+  };
+  const onDecimalAsStringChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...options.jsonData, decimalAsString: event.target.checked } });
+  };
+  const onIntervalAsStringChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...options.jsonData, intervalAsString: event.target.checked } });
+  };
+  const onBinaryEncodingChange = (encoding: SelectableValue<BinaryEncoding>) => {
+    onOptionsChange({ ...options, jsonData: { ...options.jsonData, binaryEncoding: encoding.value } });
+  };
+  const onNumberChange =
+    (key: 'queryTimeout' | 'maxRows' | 'maxResultBytes' | 'maxRowsCeiling' | 'maxResultBytesCeiling') =>
+    (event: ChangeEvent<HTMLInputElement>) => {
+      const value = parseInt(event.target.value, 10);
+      onOptionsChange({ ...options, jsonData: { ...options.jsonData, [key]: Number.isNaN(value) ? undefined : value } });
+    };
+  const onUserMappingChange = (mapping: SelectableValue<UserMapping>) => {
+    onOptionsChange({ ...options, jsonData: { ...options.jsonData, userMapping: mapping.value } });
+  };
+  const onUserMappingPatternChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...options.jsonData, userMappingPattern: event.target.value } });
+  };
+  const onUserMappingReplacementChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...options.jsonData, userMappingReplacement: event.target.value } });
+  };
+  const onUserMappingTableChange = (userMappingTable: Record<string, string>) => {
+    onOptionsChange({ ...options, jsonData: { ...options.jsonData, userMappingTable } });
+  };
   const onTokenChange = (event: ChangeEvent<HTMLInputElement>) => {
     onOptionsChange({ ...options, secureJsonData: { ...options.secureJsonData, accessToken: event.target.value } });
   };
@@ -24,9 +80,21 @@ export function ConfigEditor(props: Props) {
   const onTokenUrlChange = (event: ChangeEvent<HTMLInputElement>) => {
     onOptionsChange({ ...options, jsonData: { ...options.jsonData, tokenUrl: event.target.value } });
   };
+  const onIssuerUrlChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...options.jsonData, issuerUrl: event.target.value } });
+  };
   const onClientIdChange = (event: ChangeEvent<HTMLInputElement>) => {
     onOptionsChange({ ...options, jsonData: { ...options.jsonData, clientId: event.target.value } });
   };
+  const onScopesChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...options.jsonData, scopes: event.target.value } });
+  };
+  const onAudienceChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...options.jsonData, audience: event.target.value } });
+  };
+  const onResourceChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...options.jsonData, resource: event.target.value } });
+  };
   const onClientSecretChange = (event: ChangeEvent<HTMLInputElement>) => {
     onOptionsChange({ ...options, secureJsonData: { ...options.secureJsonData, clientSecret: event.target.value } });
   };
@@ -37,15 +105,55 @@ export function ConfigEditor(props: Props) {
       secureJsonData: { ...options.secureJsonData, clientSecret: '' },
     });
   };
+  const onTokenAuthMethodChange = (method: SelectableValue<TokenAuthMethod>) => {
+    onOptionsChange({ ...options, jsonData: { ...options.jsonData, tokenAuthMethod: method.value } });
+  };
+  const onClientKeyIdChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...options.jsonData, clientKeyId: event.target.value } });
+  };
+  const onClientPrivateKeyChange = (event: ChangeEvent<HTMLTextAreaElement>) => {
+    onOptionsChange({
+      ...options,
+      secureJsonData: { ...options.secureJsonData, clientPrivateKey: event.target.value },
+    });
+  };
+  const onResetClientPrivateKey = () => {
+    onOptionsChange({
+      ...options,
+      secureJsonFields: { ...options.secureJsonFields, clientPrivateKey: false },
+      secureJsonData: { ...options.secureJsonData, clientPrivateKey: '' },
+    });
+  };
+  const onTokenExchangeChange = (exchange: SelectableValue<TokenExchange | ''>) => {
+    onOptionsChange({ ...options, jsonData: { ...options.jsonData, tokenExchange: exchange.value || undefined } });
+  };
+  const onTokenExchangeUserParamChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...options.jsonData, tokenExchangeUserParam: event.target.value } });
+  };
   const onImpersonationUserChange = (event: ChangeEvent<HTMLInputElement>) => {
     onOptionsChange({ ...options, jsonData: { ...options.jsonData, impersonationUser: event.target.value } });
   };
   const onRolesChange = (event: ChangeEvent<HTMLInputElement>) => {
     onOptionsChange({ ...options, jsonData: { ...options.jsonData, roles: event.target.value } });
   };
+  const onRoleRulesChange = (roleRules: RoleRule[]) => {
+    onOptionsChange({ ...options, jsonData: { ...options.jsonData, roleRules } });
+  };
+  const onTeamsHeaderChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...options.jsonData, teamsHeader: event.target.value } });
+  };
   const onClientTagsChange = (event: ChangeEvent<HTMLInputElement>) => {
     onOptionsChange({ ...options, jsonData: { ...options.jsonData, clientTags: event.target.value } });
   };
+  const onSessionPropertiesChange = (sessionProperties: Record<string, string>) => {
+    onOptionsChange({ ...options, jsonData: { ...options.jsonData, sessionProperties } });
+  };
+  const onDefaultCatalogChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...options.jsonData, defaultCatalog: event.target.value } });
+  };
+  const onDefaultSchemaChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...options.jsonData, defaultSchema: event.target.value } });
+  };
 
   return (
     <div className="gf-form-group">
@@ -66,6 +174,194 @@ export function ConfigEditor(props: Props) {
             />
           </InlineField>
         </div>
+        {options.jsonData?.enableImpersonation && (
+          <div className="gf-form-inline">
+            <InlineField label="Trino user" tooltip="How the Trino user is derived from the Grafana user" labelWidth={26}>
+              <Select
+                options={SelectableUserMappings}
+                value={options.jsonData?.userMapping ?? 'login'}
+                onChange={onUserMappingChange}
+                width={40}
+              />
+            </InlineField>
+          </div>
+        )}
+        {options.jsonData?.enableImpersonation && options.jsonData?.userMapping === 'regex' && (
+          <div className="gf-form-inline">
+            <InlineField label="Login pattern" tooltip="Regular expression the Grafana login must match" labelWidth={26}>
+              <Input
+                value={options.jsonData?.userMappingPattern ?? ''}
+                onChange={onUserMappingPatternChange}
+                width={40}
+                placeholder="^(.*)@example\.com$"
+              />
+            </InlineField>
+            <InlineField label="Replacement" tooltip="Trino user, referring to the pattern groups as $1, $2, ..." labelWidth={16}>
+              <Input
+                value={options.jsonData?.userMappingReplacement ?? ''}
+                onChange={onUserMappingReplacementChange}
+                width={20}
+                placeholder="$1"
+              />
+            </InlineField>
+          </div>
+        )}
+        {options.jsonData?.enableImpersonation && options.jsonData?.userMapping === 'lookup' && (
+          <div className="gf-form-inline">
+            <InlineField
+              label="User mapping table"
+              tooltip="Trino user of each Grafana login. Users missing from the table are rejected."
+              labelWidth={26}
+            >
+              <KeyValueEditor
+                value={options.jsonData?.userMappingTable}
+                onChange={onUserMappingTableChange}
+                keyPlaceholder="Grafana login"
+                valuePlaceholder="Trino user"
+              />
+            </InlineField>
+          </div>
+        )}
+        <div className="gf-form-inline">
+          <InlineField
+            label="Read-only"
+            tooltip="If enabled, only SELECT, WITH, SHOW, DESCRIBE, EXPLAIN and VALUES statements can be run"
+            labelWidth={26}
+          >
+            <InlineSwitch id="trino-settings-read-only" value={options.jsonData?.readOnly ?? false} onChange={onReadOnlyChange} />
+          </InlineField>
+        </div>
+        <div className="gf-form-inline">
+          <InlineField
+            label="Flatten rows"
+            tooltip="If enabled, ROW columns are returned as a column per row field, e.g. point.x, instead of JSON"
+            labelWidth={26}
+          >
+            <InlineSwitch
+              id="trino-settings-flatten-rows"
+              value={options.jsonData?.flattenRows ?? false}
+              onChange={onFlattenRowsChange}
+            />
+          </InlineField>
+        </div>
+        <div className="gf-form-inline">
+          <InlineField
+            label="Decimals as strings"
+            tooltip="If enabled, DECIMAL columns are returned as strings keeping their exact value, instead of numbers"
+            labelWidth={26}
+          >
+            <InlineSwitch
+              id="trino-settings-decimal-as-string"
+              value={options.jsonData?.decimalAsString ?? false}
+              onChange={onDecimalAsStringChange}
+            />
+          </InlineField>
+        </div>
+        <div className="gf-form-inline">
+          <InlineField
+            label="Intervals as strings"
+            tooltip="If enabled, INTERVAL columns are returned as strings, instead of milliseconds (day to second) and months (year to month)"
+            labelWidth={26}
+          >
+            <InlineSwitch
+              id="trino-settings-interval-as-string"
+              value={options.jsonData?.intervalAsString ?? false}
+              onChange={onIntervalAsStringChange}
+            />
+          </InlineField>
+        </div>
+        <div className="gf-form-inline">
+          <InlineField
+            label="Binary encoding"
+            tooltip="How VARBINARY and sketch (HyperLogLog, P4HyperLogLog, QDigest, TDigest) values are shown. Invalid UTF-8 is replaced."
+            labelWidth={26}
+          >
+            <Select
+              options={SelectableBinaryEncodings}
+              value={options.jsonData?.binaryEncoding ?? 'hex'}
+              onChange={onBinaryEncodingChange}
+              width={40}
+            />
+          </InlineField>
+        </div>
+        <div className="gf-form-inline">
+          <InlineField
+            label="Query timeout"
+            tooltip="Timeout of queries in seconds, after which they are canceled in Trino. Queries can override it. Empty for no timeout."
+            labelWidth={26}
+          >
+            <Input
+              type="number"
+              min={0}
+              value={options.jsonData?.queryTimeout ?? ''}
+              onChange={onNumberChange('queryTimeout')}
+              width={40}
+              placeholder="300"
+            />
+          </InlineField>
+        </div>
+        <div className="gf-form-inline">
+          <InlineField
+            label="Max rows"
+            tooltip="Results of queries are truncated to this number of rows, and the query is stopped. Queries can override it. Empty for no limit."
+            labelWidth={26}
+          >
+            <Input
+              type="number"
+              min={0}
+              value={options.jsonData?.maxRows ?? ''}
+              onChange={onNumberChange('maxRows')}
+              width={40}
+              placeholder="100000"
+            />
+          </InlineField>
+        </div>
+        <div className="gf-form-inline">
+          <InlineField
+            label="Max result size"
+            tooltip="Results of queries are truncated to this estimated size in bytes, and the query is stopped. Queries can override it. Empty for no limit."
+            labelWidth={26}
+          >
+            <Input
+              type="number"
+              min={0}
+              value={options.jsonData?.maxResultBytes ?? ''}
+              onChange={onNumberChange('maxResultBytes')}
+              width={40}
+              placeholder="104857600"
+            />
+          </InlineField>
+        </div>
+        <div className="gf-form-inline">
+          <InlineField
+            label="Max rows ceiling"
+            tooltip="Highest row limit queries can set. Empty for no ceiling."
+            labelWidth={26}
+          >
+            <Input
+              type="number"
+              min={0}
+              value={options.jsonData?.maxRowsCeiling ?? ''}
+              onChange={onNumberChange('maxRowsCeiling')}
+              width={40}
+            />
+          </InlineField>
+        </div>
+        <div className="gf-form-inline">
+          <InlineField
+            label="Max result size ceiling"
+            tooltip="Highest result size limit in bytes queries can set. Empty for no ceiling."
+            labelWidth={26}
+          >
+            <Input
+              type="number"
+              min={0}
+              value={options.jsonData?.maxResultBytesCeiling ?? ''}
+              onChange={onNumberChange('maxResultBytesCeiling')}
+              width={40}
+            />
+          </InlineField>
+        </div>
         <div className="gf-form-inline">
           <InlineField label="Access token" tooltip="If set, use the access token for authentication to Trino" labelWidth={26}>
             <SecretInput
@@ -86,6 +382,24 @@ export function ConfigEditor(props: Props) {
             <Input value={options.jsonData?.roles ?? ''} onChange={onRolesChange} width={40} />
           </InlineField>
         </div>
+        <div className="gf-form-inline">
+          <InlineField
+            label="Role rules"
+            tooltip="Roles granted to the users with an org role or in a team, replacing the roles above for their catalogs. Org role rules also match the higher org roles, e.g. a Viewer rule matches editors and admins, so put the rules of higher roles first. The first matching rule wins."
+            labelWidth={26}
+          >
+            <RoleRulesEditor value={options.jsonData?.roleRules} onChange={onRoleRulesChange} />
+          </InlineField>
+        </div>
+        <div className="gf-form-inline">
+          <InlineField
+            label="Teams header"
+            tooltip="Request header with the comma-separated teams of the user, required by team rules. Grafana doesn't set it: it must be set by a trusted authentication proxy in front of Grafana, which removes the values sent by clients, as otherwise users can grant themselves the roles of any team. Grafana must forward it to the data source, otherwise team rules match no users and a warning is logged."
+            labelWidth={26}
+          >
+            <Input value={options.jsonData?.teamsHeader ?? ''} onChange={onTeamsHeaderChange} width={40} placeholder="X-Grafana-Teams" />
+          </InlineField>
+        </div>
         <div className="gf-form-inline">
           <InlineField
             label="Client Tags"
@@ -95,6 +409,39 @@ export function ConfigEditor(props: Props) {
             <Input value={options.jsonData?.clientTags ?? ''} onChange={onClientTagsChange} width={60} placeholder="tag1,tag2,tag3" />
           </InlineField>
         </div>
+        <div className="gf-form-inline">
+          <InlineField
+            label="Session properties"
+            tooltip="Session properties of the queries, e.g. query_max_run_time or hive.parquet_use_column_names. Queries can override them."
+            labelWidth={26}
+          >
+            <KeyValueEditor
+              value={options.jsonData?.sessionProperties}
+              onChange={onSessionPropertiesChange}
+              validate={validateSessionProperty}
+              keyPlaceholder="query_max_run_time"
+              valuePlaceholder="10m"
+            />
+          </InlineField>
+        </div>
+        <div className="gf-form-inline">
+          <InlineField
+            label="Default catalog"
+            tooltip="Catalog used to resolve unqualified table names"
+            labelWidth={26}
+          >
+            <Input value={options.jsonData?.defaultCatalog ?? ''} onChange={onDefaultCatalogChange} width={40} placeholder="tpch" />
+          </InlineField>
+        </div>
+        <div className="gf-form-inline">
+          <InlineField
+            label="Default schema"
+            tooltip="Schema used to resolve unqualified table names. Requires a default catalog"
+            labelWidth={26}
+          >
+            <Input value={options.jsonData?.defaultSchema ?? ''} onChange={onDefaultSchemaChange} width={40} placeholder="tiny" />
+          </InlineField>
+        </div>
       </div>
 
       <h3 className="page-heading">OAuth Trino Authentication</h3>
@@ -109,21 +456,119 @@ export function ConfigEditor(props: Props) {
           </InlineField>
         </div>
         <div className="gf-form-inline">
-          <InlineField label="Client id" tooltip="Required if Token URL is set" labelWidth={26}>
+          <InlineField
+            label="Issuer URL"
+            tooltip="If set instead of the Token URL, the token endpoint is discovered from the OpenID configuration of the issuer"
+            labelWidth={26}
+          >
+            <Input value={options.jsonData?.issuerUrl ?? ''} onChange={onIssuerUrlChange} width={60} />
+          </InlineField>
+        </div>
+        <div className="gf-form-inline">
+          <InlineField label="Client id" tooltip="Required if Token URL or Issuer URL is set" labelWidth={26}>
             <Input value={options.jsonData?.clientId ?? ''} onChange={onClientIdChange} width={60} />
           </InlineField>
         </div>
         <div className="gf-form-inline">
-          <InlineField label="Client secret" tooltip="Required if Token URL is set" labelWidth={26}>
-            <SecretInput
-              value={options.secureJsonData?.clientSecret ?? ''}
-              isConfigured={options.secureJsonFields?.clientSecret}
-              onChange={onClientSecretChange}
+          <InlineField
+            label="Authentication method"
+            tooltip="How the client authenticates to the token endpoint"
+            labelWidth={26}
+          >
+            <Select
+              options={SelectableTokenAuthMethods}
+              value={options.jsonData?.tokenAuthMethod ?? 'client_secret_post'}
+              onChange={onTokenAuthMethodChange}
+              width={60}
+            />
+          </InlineField>
+        </div>
+        {options.jsonData?.tokenAuthMethod === 'private_key_jwt' ? (
+          <>
+            <div className="gf-form-inline">
+              <InlineField
+                label="Client private key"
+                tooltip="PEM encoded RSA or EC private key signing the client assertions"
+                labelWidth={26}
+              >
+                <SecretTextArea
+                  value={options.secureJsonData?.clientPrivateKey ?? ''}
+                  isConfigured={options.secureJsonFields?.clientPrivateKey}
+                  onChange={onClientPrivateKeyChange}
+                  onReset={onResetClientPrivateKey}
+                  cols={60}
+                  rows={8}
+                />
+              </InlineField>
+            </div>
+            <div className="gf-form-inline">
+              <InlineField label="Client key id" tooltip="If set, sent as the kid of the client assertions" labelWidth={26}>
+                <Input value={options.jsonData?.clientKeyId ?? ''} onChange={onClientKeyIdChange} width={60} />
+              </InlineField>
+            </div>
+          </>
+        ) : (
+          <div className="gf-form-inline">
+            <InlineField label="Client secret" tooltip="Required if Token URL or Issuer URL is set" labelWidth={26}>
+              <SecretInput
+                value={options.secureJsonData?.clientSecret ?? ''}
+                isConfigured={options.secureJsonFields?.clientSecret}
+                onChange={onClientSecretChange}
+                width={60}
+                onReset={onResetClientSecret}
+              />
+            </InlineField>
+          </div>
+        )}
+        <div className="gf-form-inline">
+          <InlineField label="Scopes" tooltip="Scopes of the token, separated by spaces" labelWidth={26}>
+            <Input value={options.jsonData?.scopes ?? ''} onChange={onScopesChange} width={60} placeholder="openid" />
+          </InlineField>
+        </div>
+        <div className="gf-form-inline">
+          <InlineField label="Audience" tooltip="Audience of the token, required by some identity providers" labelWidth={26}>
+            <Input value={options.jsonData?.audience ?? ''} onChange={onAudienceChange} width={60} />
+          </InlineField>
+        </div>
+        <div className="gf-form-inline">
+          <InlineField
+            label="Resource"
+            tooltip="Resource the token is requested for, required by some identity providers"
+            labelWidth={26}
+          >
+            <Input value={options.jsonData?.resource ?? ''} onChange={onResourceChange} width={60} />
+          </InlineField>
+        </div>
+        <div className="gf-form-inline">
+          <InlineField
+            label="Token exchange"
+            tooltip="If enabled, queries use a token of the Grafana user, exchanged at the token endpoint (RFC 8693), instead of the client token. The forwarded user token requires Forward OAuth Identity."
+            labelWidth={26}
+          >
+            <Select
+              options={SelectableTokenExchanges}
+              value={options.jsonData?.tokenExchange ?? ''}
+              onChange={onTokenExchangeChange}
               width={60}
-              onReset={onResetClientSecret}
             />
           </InlineField>
         </div>
+        {options.jsonData?.tokenExchange === 'client' && (
+          <div className="gf-form-inline">
+            <InlineField
+              label="Token exchange user parameter"
+              tooltip="Parameter naming the user when the client token is exchanged. RFC 8693 has no such parameter, the default requested_subject is the one of Keycloak."
+              labelWidth={26}
+            >
+              <Input
+                value={options.jsonData?.tokenExchangeUserParam ?? ''}
+                onChange={onTokenExchangeUserParamChange}
+                placeholder="requested_subject"
+                width={60}
+              />
+            </InlineField>
+          </div>
+        )}
         <div className="gf-form-inline">
           <InlineField label="Impersonation user" tooltip="If set, this user will be used for impersonation in Trino" labelWidth={26}>
             <Input value={options.jsonData?.impersonationUser ?? ''} onChange={onImpersonationUserChange} width={60} />
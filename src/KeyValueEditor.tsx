@@ -0,0 +1,64 @@
+import React, { ChangeEvent, useState } from 'react';
+import { Button, IconButton, InlineField, Input } from '@grafana/ui';
+
+interface Props {
+  value?: Record<string, string>;
+  onChange: (value: Record<string, string>) => void;
+  keyPlaceholder?: string;
+  valuePlaceholder?: string;
+  /**
+   * Returns why an entry is invalid, if it is. Invalid entries are kept in the editor but not saved.
+   */
+  validate?: (key: string, value: string) => string | undefined;
+  width?: number;
+}
+
+type Entry = [string, string];
+
+/**
+ * Edits a map of strings, such as session properties or the user mapping table, as a list of entries.
+ */
+export function KeyValueEditor({ value, onChange, keyPlaceholder, valuePlaceholder, validate, width = 20 }: Props) {
+  const [entries, setEntries] = useState<Entry[]>(() => Object.entries(value ?? {}));
+
+  const errorOf = ([key, val]: Entry) => (key === '' ? undefined : validate?.(key, val));
+
+  const update = (updated: Entry[]) => {
+    setEntries(updated);
+    const saved: Record<string, string> = {};
+    for (const entry of updated) {
+      if (entry[0] !== '' && errorOf(entry) === undefined) {
+        saved[entry[0]] = entry[1];
+      }
+    }
+    onChange(saved);
+  };
+  const onKeyChange = (index: number) => (event: ChangeEvent<HTMLInputElement>) =>
+    update(entries.map((entry, i): Entry => (i === index ? [event.target.value, entry[1]] : entry)));
+  const onValueChange = (index: number) => (event: ChangeEvent<HTMLInputElement>) =>
+    update(entries.map((entry, i): Entry => (i === index ? [entry[0], event.target.value] : entry)));
+  const onRemove = (index: number) => () => update(entries.filter((_, i) => i !== index));
+  const onAdd = () => setEntries([...entries, ['', '']]);
+
+  return (
+    <div>
+      {entries.map((entry, index) => {
+        const error = errorOf(entry);
+        return (
+          <div className="gf-form-inline" key={index}>
+            <InlineField invalid={error !== undefined} error={error}>
+              <Input value={entry[0]} onChange={onKeyChange(index)} placeholder={keyPlaceholder} width={width} />
+            </InlineField>
+            <InlineField invalid={error !== undefined}>
+              <Input value={entry[1]} onChange={onValueChange(index)} placeholder={valuePlaceholder} width={width} />
+            </InlineField>
+            <IconButton name="trash-alt" tooltip="Remove" onClick={onRemove(index)} />
+          </div>
+        );
+      })}
+      <Button icon="plus" variant="secondary" size="sm" onClick={onAdd}>
+        Add
+      </Button>
+    </div>
+  );
+}
@@ -1,8 +1,15 @@
-import React from 'react';
+import React, { ChangeEvent } from 'react';
 import { QueryEditorProps } from '@grafana/data';
-import { CodeEditor, InlineField, Select } from '@grafana/ui';
+import { CodeEditor, InlineField, Input, Select } from '@grafana/ui';
 import { DataSource } from './datasource';
-import { TrinoDataSourceOptions, TrinoQuery, defaultQuery, SelectableFormatOptions } from './types';
+import {
+  TrinoDataSourceOptions,
+  TrinoQuery,
+  defaultQuery,
+  SelectableFormatOptions,
+  validateSessionProperty,
+} from './types';
+import { KeyValueEditor } from './KeyValueEditor';
 
 type Props = QueryEditorProps<DataSource, TrinoQuery, TrinoDataSourceOptions>;
 
@@ -23,6 +30,23 @@ export function QueryEditor(props: Props) {
     onRunQuery();
   };
 
+  const onCatalogChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onChange({ ...query, catalog: event.target.value });
+  };
+
+  const onSchemaChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onChange({ ...query, schema: event.target.value });
+  };
+
+  const onSessionPropertiesChange = (sessionProperties: Record<string, string>) => {
+    onChange({ ...query, sessionProperties });
+  };
+
+  const onNumberChange = (key: 'timeout' | 'maxRows' | 'maxResultBytes') => (event: ChangeEvent<HTMLInputElement>) => {
+    const value = parseInt(event.target.value, 10);
+    onChange({ ...query, [key]: Number.isNaN(value) ? undefined : value });
+  };
+
   return (
     <>
       <div className="gf-form-group">
@@ -34,6 +58,59 @@ export function QueryEditor(props: Props) {
             width={30}
           />
         </InlineField>
+        <InlineField label="Catalog" labelWidth={16} tooltip="Overrides the data source default catalog">
+          <Input value={query.catalog ?? ''} onChange={onCatalogChange} onBlur={onRunQuery} width={30} />
+        </InlineField>
+        <InlineField label="Schema" labelWidth={16} tooltip="Overrides the data source default schema">
+          <Input value={query.schema ?? ''} onChange={onSchemaChange} onBlur={onRunQuery} width={30} />
+        </InlineField>
+        <InlineField label="Timeout" labelWidth={16} tooltip="Overrides the data source query timeout, in seconds">
+          <Input
+            type="number"
+            min={0}
+            value={query.timeout ?? ''}
+            onChange={onNumberChange('timeout')}
+            onBlur={onRunQuery}
+            width={30}
+          />
+        </InlineField>
+        <InlineField label="Max rows" labelWidth={16} tooltip="Overrides the data source row limit, up to its ceiling">
+          <Input
+            type="number"
+            min={0}
+            value={query.maxRows ?? ''}
+            onChange={onNumberChange('maxRows')}
+            onBlur={onRunQuery}
+            width={30}
+          />
+        </InlineField>
+        <InlineField
+          label="Max result size"
+          labelWidth={16}
+          tooltip="Overrides the data source result size limit in bytes, up to its ceiling"
+        >
+          <Input
+            type="number"
+            min={0}
+            value={query.maxResultBytes ?? ''}
+            onChange={onNumberChange('maxResultBytes')}
+            onBlur={onRunQuery}
+            width={30}
+          />
+        </InlineField>
+        <InlineField
+          label="Session properties"
+          labelWidth={16}
+          tooltip="Override the data source session properties for this query"
+        >
+          <KeyValueEditor
+            value={query.sessionProperties}
+            onChange={onSessionPropertiesChange}
+            validate={validateSessionProperty}
+            keyPlaceholder="query_max_run_time"
+            valuePlaceholder="10m"
+          />
+        </InlineField>
       </div>
       <div style={{ minWidth: '400px', marginLeft: '10px', flex: 1 }}>
         <CodeEditor
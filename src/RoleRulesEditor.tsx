@@ -0,0 +1,76 @@
+import React, { ChangeEvent } from 'react';
+import { Button, IconButton, InlineField, Input, Select } from '@grafana/ui';
+import { SelectableValue } from '@grafana/data';
+import { RoleRule } from './types';
+
+type OrgRole = NonNullable<RoleRule['orgRole']>;
+type Subject = 'orgRole' | 'team';
+
+const SelectableSubjects: Array<SelectableValue<Subject>> = [
+  { label: 'Org role', value: 'orgRole' },
+  { label: 'Team', value: 'team' },
+];
+
+const SelectableOrgRoles: Array<SelectableValue<OrgRole>> = [
+  { label: 'Viewer', value: 'Viewer' },
+  { label: 'Editor', value: 'Editor' },
+  { label: 'Admin', value: 'Admin' },
+];
+
+interface Props {
+  value?: RoleRule[];
+  onChange: (value: RoleRule[]) => void;
+}
+
+/**
+ * Edits the role rules, granting Trino roles to the users with an org role or in a team. The first matching rule
+ * wins.
+ */
+export function RoleRulesEditor({ value = [], onChange }: Props) {
+  const update = (index: number, rule: RoleRule) => onChange(value.map((r, i) => (i === index ? rule : r)));
+
+  const onSubjectChange = (index: number) => (subject: SelectableValue<Subject>) =>
+    update(
+      index,
+      subject.value === 'team' ? { team: '', roles: value[index].roles } : { orgRole: 'Viewer', roles: value[index].roles }
+    );
+  const onOrgRoleChange = (index: number) => (orgRole: SelectableValue<OrgRole>) =>
+    update(index, { ...value[index], orgRole: orgRole.value });
+  const onTeamChange = (index: number) => (event: ChangeEvent<HTMLInputElement>) =>
+    update(index, { ...value[index], team: event.target.value });
+  const onRolesChange = (index: number) => (event: ChangeEvent<HTMLInputElement>) =>
+    update(index, { ...value[index], roles: event.target.value });
+  const onRemove = (index: number) => () => onChange(value.filter((_, i) => i !== index));
+  const onAdd = () => onChange([...value, { orgRole: 'Viewer', roles: '' }]);
+
+  return (
+    <div>
+      {value.map((rule, index) => (
+        <div className="gf-form-inline" key={index}>
+          <InlineField>
+            <Select
+              options={SelectableSubjects}
+              value={rule.team !== undefined ? 'team' : 'orgRole'}
+              onChange={onSubjectChange(index)}
+              width={14}
+            />
+          </InlineField>
+          <InlineField>
+            {rule.team !== undefined ? (
+              <Input value={rule.team} onChange={onTeamChange(index)} placeholder="Team" width={20} />
+            ) : (
+              <Select options={SelectableOrgRoles} value={rule.orgRole} onChange={onOrgRoleChange(index)} width={20} />
+            )}
+          </InlineField>
+          <InlineField>
+            <Input value={rule.roles} onChange={onRolesChange(index)} placeholder="system:analyst;hive:reader" width={40} />
+          </InlineField>
+          <IconButton name="trash-alt" tooltip="Remove" onClick={onRemove(index)} />
+        </div>
+      ))}
+      <Button icon="plus" variant="secondary" size="sm" onClick={onAdd}>
+        Add rule
+      </Button>
+    </div>
+  );
+}
@@ -0,0 +1,22 @@
+import { validateSessionProperty } from './types';
+
+describe('validateSessionProperty', () => {
+  it.each([
+    ['query_max_run_time', '10m'],
+    ['hive.parquet_use_column_names', 'true'],
+    ['my-catalog.optimize_hash_generation', 'false'],
+  ])('accepts %s=%s', (name, value) => {
+    expect(validateSessionProperty(name, value)).toBeUndefined();
+  });
+
+  it.each([
+    ['query max run time', '10m'],
+    ['hive.', 'true'],
+    ['1property', 'true'],
+    ['query_max_run_time', ''],
+    ['query_max_run_time', '10 m'],
+    ['query_max_run_time', '10m;x=y'],
+  ])('rejects %s=%s', (name, value) => {
+    expect(validateSessionProperty(name, value)).toBeDefined();
+  });
+});
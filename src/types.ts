@@ -8,6 +8,32 @@ export enum FormatOptions {
 export interface TrinoQuery extends DataQuery {
   rawSQL?: string;
   format?: FormatOptions;
+  sessionProperties?: Record<string, string>;
+  catalog?: string;
+  schema?: string;
+  timeout?: number;
+  maxRows?: number;
+  maxResultBytes?: number;
+}
+
+const sessionPropertyName = /^([A-Za-z0-9_][A-Za-z0-9_-]*\.)?[A-Za-z_][A-Za-z0-9_]*$/;
+const sessionPropertyValue = /^[!-:<-~]+$/;
+
+/**
+ * Returns why a session property is invalid, checking it like the backend: names are system or catalog property
+ * names, and values are printable ASCII without spaces or ';'.
+ */
+export function validateSessionProperty(name: string, value: string): string | undefined {
+  if (!sessionPropertyName.test(name)) {
+    return `Invalid session property name "${name}"`;
+  }
+  if (value === '') {
+    return `Session property "${name}" must have a value`;
+  }
+  if (!sessionPropertyValue.test(value)) {
+    return 'Value must be printable ASCII without spaces or ";"';
+  }
+  return undefined;
 }
 
 export const SelectableFormatOptions: Array<SelectableValue<FormatOptions>> = [
@@ -46,18 +72,90 @@ ORDER BY
  * These are options configured for each DataSource instance.
  */
 
+export type UserMapping = 'login' | 'email' | 'emailLocalPart' | 'regex' | 'lookup';
+
+export const SelectableUserMappings: Array<SelectableValue<UserMapping>> = [
+  { label: 'Login', value: 'login' },
+  { label: 'Email', value: 'email' },
+  { label: 'Email local part', value: 'emailLocalPart' },
+  { label: 'Regex rewrite of login', value: 'regex' },
+  { label: 'Lookup table', value: 'lookup' },
+];
+
+export type BinaryEncoding = 'hex' | 'base64' | 'utf8';
+
+export const SelectableBinaryEncodings: Array<SelectableValue<BinaryEncoding>> = [
+  { label: 'Hex', value: 'hex' },
+  { label: 'Base64', value: 'base64' },
+  { label: 'UTF-8', value: 'utf8' },
+];
+
+export type TokenAuthMethod = 'client_secret_post' | 'client_secret_basic' | 'private_key_jwt';
+
+export const SelectableTokenAuthMethods: Array<SelectableValue<TokenAuthMethod>> = [
+  { label: 'Client secret in the form', value: 'client_secret_post' },
+  { label: 'Client secret with HTTP Basic', value: 'client_secret_basic' },
+  { label: 'Signed JWT with private key', value: 'private_key_jwt' },
+];
+
+export type TokenExchange = 'client' | 'forwarded';
+
+export const SelectableTokenExchanges: Array<SelectableValue<TokenExchange | ''>> = [
+  { label: 'Disabled', value: '' },
+  { label: 'Exchange the client token', value: 'client' },
+  { label: 'Exchange the forwarded user token', value: 'forwarded' },
+];
+
 export interface TrinoSecureJsonData {
   accessToken?: string;
   clientSecret?: string;
+  clientPrivateKey?: string;
 }
 
 export interface TrinoDataSourceOptions extends DataSourceJsonData {
   enableImpersonation?: boolean;
   tokenUrl?: string;
+  issuerUrl?: string;
   clientId?: string;
+  scopes?: string;
+  audience?: string;
+  resource?: string;
+  tokenParams?: Record<string, string>;
+  tokenAuthMethod?: TokenAuthMethod;
+  clientKeyId?: string;
+  tokenExchange?: TokenExchange;
+  tokenExchangeUserParam?: string;
   impersonationUser?: string;
   roles?: string;
   clientTags?: string;
+  sessionProperties?: Record<string, string>;
+  defaultCatalog?: string;
+  defaultSchema?: string;
+  userMapping?: UserMapping;
+  userMappingPattern?: string;
+  userMappingReplacement?: string;
+  userMappingTable?: Record<string, string>;
+  roleRules?: RoleRule[];
+  teamsHeader?: string;
+  readOnly?: boolean;
+  flattenRows?: boolean;
+  decimalAsString?: boolean;
+  intervalAsString?: boolean;
+  binaryEncoding?: BinaryEncoding;
+  queryTimeout?: number;
+  maxRows?: number;
+  maxResultBytes?: number;
+  maxRowsCeiling?: number;
+  maxResultBytesCeiling?: number;
+}
+
+/**
+ * Grants Trino roles, formatted like `roles`, to users with the org role or in the team.
+ */
+export interface RoleRule {
+  orgRole?: 'Viewer' | 'Editor' | 'Admin';
+  team?: string;
+  roles: string;
 }
 /**
  * Value that is used in the backend, but never sent over HTTP to the frontend